@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Master290/internetometer-cli/pkg/yandex"
+	"go.yaml.in/yaml/v2"
+)
+
+// formatOptions are the flags that tweak how a formatter lays a report out.
+type formatOptions struct {
+	// Header writes the column names before the rows of csv and tsv.
+	Header bool
+	// Servers adds the per-host latency table to text output.
+	Servers bool
+	// Unit is how text and template output print speeds.
+	Unit yandex.SpeedUnit
+}
+
+// formatter writes a report to w in one output format.
+type formatter func(w io.Writer, r *yandex.Report, opts formatOptions) error
+
+// formatters is the registry behind --format.
+var formatters = map[string]formatter{
+	"text": func(w io.Writer, r *yandex.Report, opts formatOptions) error {
+		printText(w, r, opts)
+		return nil
+	},
+	"json": func(w io.Writer, r *yandex.Report, _ formatOptions) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	},
+	"ndjson": func(w io.Writer, r *yandex.Report, _ formatOptions) error {
+		return json.NewEncoder(w).Encode(r)
+	},
+	"yaml":     writeYAML,
+	"csv":      writeDelimited(','),
+	"tsv":      writeDelimited('\t'),
+	"markdown": writeMarkdown,
+	"prometheus": func(w io.Writer, r *yandex.Report, _ formatOptions) error {
+		printPrometheus(w, r)
+		return nil
+	},
+}
+
+// formatNames lists the registered formats for help and error messages.
+func formatNames() string {
+	return strings.Join(slices.Sorted(maps.Keys(formatters)), ", ")
+}
+
+// writeYAML goes through JSON so that YAML keys match the JSON ones and
+// keep their order.
+func writeYAML(w io.Writer, r *yandex.Report, _ formatOptions) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// column is one field of the flat, one-row-per-speed-test layout shared by
+// csv, tsv and markdown.
+type column struct {
+	name  string
+	value func(r *yandex.Report, s *yandex.SpeedReport) string
+}
+
+var columns = []column{
+	{"time", func(r *yandex.Report, _ *yandex.SpeedReport) string { return r.Time.Format(time.RFC3339) }},
+	{"ipv4", network(func(n *yandex.NetworkInfo) string { return n.IPv4 })},
+	{"ipv6", network(func(n *yandex.NetworkInfo) string { return n.IPv6 })},
+	{"region", network(func(n *yandex.NetworkInfo) string { return n.Region })},
+	{"isp", network(func(n *yandex.NetworkInfo) string { return n.ISP })},
+	{"asn", network(func(n *yandex.NetworkInfo) string {
+		if n.ASN == 0 {
+			return ""
+		}
+		return strconv.Itoa(n.ASN)
+	})},
+	{"interface", network(func(n *yandex.NetworkInfo) string { return n.Interface })},
+	{"ip_family", speed(func(s *yandex.SpeedReport) string { return s.IPFamily })},
+	{"provider", speed(func(s *yandex.SpeedReport) string { return s.Provider })},
+	{"server", speed(serverHost)},
+	{"download_mbps", speed(func(s *yandex.SpeedReport) string { return transferCell(s.Download) })},
+	{"upload_mbps", speed(func(s *yandex.SpeedReport) string { return transferCell(s.Upload) })},
+	{"latency_ms", latency(func(l *yandex.LatencyReport) float64 { return l.MinMs })},
+	{"jitter_ms", latency(func(l *yandex.LatencyReport) float64 { return l.JitterMs })},
+	{"median_ms", latency(func(l *yandex.LatencyReport) float64 { return l.MedianMs })},
+	{"p95_ms", latency(func(l *yandex.LatencyReport) float64 { return l.P95Ms })},
+	{"download_latency_ms", speed(func(s *yandex.SpeedReport) string { return loadedCell(s.Download) })},
+	{"upload_latency_ms", speed(func(s *yandex.SpeedReport) string { return loadedCell(s.Upload) })},
+	{"bufferbloat", speed(func(s *yandex.SpeedReport) string {
+		if s.Bufferbloat == nil {
+			return ""
+		}
+		return s.Bufferbloat.Grade
+	})},
+	{"proxy", speed(func(s *yandex.SpeedReport) string { return s.ProxyString() })},
+	{"errors", func(r *yandex.Report, s *yandex.SpeedReport) string { return strings.Join(rowErrors(r, s), "; ") }},
+}
+
+func network(f func(n *yandex.NetworkInfo) string) func(*yandex.Report, *yandex.SpeedReport) string {
+	return func(r *yandex.Report, _ *yandex.SpeedReport) string {
+		if r.Network == nil {
+			return ""
+		}
+		return f(r.Network)
+	}
+}
+
+func speed(f func(s *yandex.SpeedReport) string) func(*yandex.Report, *yandex.SpeedReport) string {
+	return func(_ *yandex.Report, s *yandex.SpeedReport) string {
+		if s == nil {
+			return ""
+		}
+		return f(s)
+	}
+}
+
+func latency(f func(l *yandex.LatencyReport) float64) func(*yandex.Report, *yandex.SpeedReport) string {
+	return speed(func(s *yandex.SpeedReport) string {
+		if s.Latency == nil || s.Latency.Error != "" {
+			return ""
+		}
+		return strconv.FormatFloat(f(s.Latency), 'f', 3, 64)
+	})
+}
+
+// serverHost is the host the download ran against, the first one when it
+// was spread over several.
+func serverHost(s *yandex.SpeedReport) string {
+	if s.Download == nil || len(s.Download.URLs) == 0 {
+		return ""
+	}
+	if u, err := url.Parse(s.Download.URLs[0]); err == nil {
+		return u.Host
+	}
+	return s.Download.URLs[0]
+}
+
+func transferCell(t *yandex.TransferReport) string {
+	if v, ok := transferMbps(t); ok {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+	return ""
+}
+
+func loadedCell(t *yandex.TransferReport) string {
+	if t == nil || t.LoadedLatency == nil {
+		return ""
+	}
+	return strconv.FormatFloat(durationMs(t.LoadedLatency.Median), 'f', 3, 64)
+}
+
+// rowErrors gathers what failed for one row: the report-wide errors, a
+// speed test that did not run and every failed phase.
+func rowErrors(r *yandex.Report, s *yandex.SpeedReport) []string {
+	errs := slices.Clone(r.Errors)
+	if s == nil {
+		return errs
+	}
+	if s.Error != "" {
+		errs = append(errs, s.Error)
+	}
+	if s.DNS != nil && s.DNS.Error != "" {
+		errs = append(errs, "dns: "+s.DNS.Error)
+	}
+	if s.Latency != nil && s.Latency.Error != "" {
+		errs = append(errs, "latency: "+s.Latency.Error)
+	}
+	if s.Download != nil && s.Download.Error != "" {
+		errs = append(errs, "download: "+s.Download.Error)
+	}
+	if s.Upload != nil && s.Upload.Error != "" {
+		errs = append(errs, "upload: "+s.Upload.Error)
+	}
+	return errs
+}
+
+// speedRows is the speed test behind each row: one per address family for
+// a dual-stack run, otherwise the single speed test, nil if none ran.
+func speedRows(r *yandex.Report) []*yandex.SpeedReport {
+	if r.DualStack == nil {
+		return []*yandex.SpeedReport{r.Speed}
+	}
+	var rows []*yandex.SpeedReport
+	for _, family := range slices.Sorted(maps.Keys(r.DualStack)) {
+		rows = append(rows, r.DualStack[family])
+	}
+	return rows
+}
+
+func writeDelimited(comma rune) formatter {
+	return func(w io.Writer, r *yandex.Report, opts formatOptions) error {
+		cw := csv.NewWriter(w)
+		cw.Comma = comma
+		if opts.Header {
+			header := make([]string, len(columns))
+			for i, c := range columns {
+				header[i] = c.name
+			}
+			cw.Write(header)
+		}
+		for _, s := range speedRows(r) {
+			row := make([]string, len(columns))
+			for i, c := range columns {
+				row[i] = c.value(r, s)
+			}
+			cw.Write(row)
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+}
+
+// writeMarkdown lays the columns out as the rows of a table, one value
+// column per speed test, leaving out fields that are empty everywhere.
+func writeMarkdown(w io.Writer, r *yandex.Report, _ formatOptions) error {
+	rows := speedRows(r)
+	header := "| " + tr("Field") + " |"
+	rule := "|---|"
+	for _, s := range rows {
+		name := tr("Value")
+		if s != nil && s.IPFamily != "" {
+			name = s.IPFamily
+		}
+		header += " " + name + " |"
+		rule += "---|"
+	}
+	fmt.Fprintln(w, header)
+	fmt.Fprintln(w, rule)
+
+	escape := strings.NewReplacer("|", `\|`, "\n", " ")
+	for _, c := range columns {
+		cells := make([]string, len(rows))
+		empty := true
+		for i, s := range rows {
+			cells[i] = escape.Replace(c.value(r, s))
+			empty = empty && cells[i] == ""
+		}
+		if empty {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "| %s | %s |\n", c.name, strings.Join(cells, " | ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Master290/internetometer-cli/pkg/yandex"
+)
+
+// speedReport is a speed test against host with every phase filled in.
+func speedReport(family, host string, download, upload float64) *yandex.SpeedReport {
+	return &yandex.SpeedReport{
+		Provider: "yandex",
+		Phases:   "latency,download,upload,loaded_latency",
+		IPFamily: family,
+		Latency: &yandex.LatencyReport{
+			MinMs:    12.3456,
+			MedianMs: 13,
+			P95Ms:    20,
+			JitterMs: 1.5,
+		},
+		Download: &yandex.TransferReport{
+			Mbps:          download,
+			URLs:          []string{"https://" + host + "/50mb"},
+			LoadedLatency: &yandex.LatencyStats{Median: 45 * time.Millisecond},
+		},
+		Upload: &yandex.TransferReport{
+			Mbps:          upload,
+			URLs:          []string{"https://" + host + "/upload"},
+			LoadedLatency: &yandex.LatencyStats{Median: 80500 * time.Microsecond},
+		},
+		Bufferbloat: &yandex.Bufferbloat{Grade: "B"},
+	}
+}
+
+// testReports are the report shapes every tabular format has to handle.
+func testReports() map[string]*yandex.Report {
+	at := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	network := &yandex.NetworkInfo{
+		IPv4:   "192.0.2.10",
+		IPv6:   "2001:db8::10",
+		Region: "Москва",
+		ISP:    "Example, Inc.",
+		ASN:    64500,
+	}
+
+	failedUpload := speedReport("ipv6", "b.example:8443", 512.25, 0)
+	failedUpload.Upload = &yandex.TransferReport{Error: "connection refused"}
+	failedUpload.Proxy = []string{"socks5://proxy.example:1080"}
+
+	return map[string]*yandex.Report{
+		"single": {
+			Time:    at,
+			Network: network,
+			Speed:   speedReport("", "a.example", 94.2, 41.5),
+		},
+		"dual-stack": {
+			Time:    at,
+			Network: network,
+			DualStack: map[string]*yandex.SpeedReport{
+				"ipv6": failedUpload,
+				"ipv4": speedReport("ipv4", "a.example", 94.2, 41.5),
+			},
+		},
+		"no speed test": {
+			Time:   at,
+			Errors: []string{"speed test: could not fetch probes"},
+		},
+	}
+}
+
+func TestWriteDelimited(t *testing.T) {
+	const (
+		csvHeader = "time,ipv4,ipv6,region,isp,asn,interface,ip_family,provider,server,download_mbps,upload_mbps,latency_ms,jitter_ms,median_ms,p95_ms,download_latency_ms,upload_latency_ms,bufferbloat,proxy,errors\n"
+		tsvHeader = "time\tipv4\tipv6\tregion\tisp\tasn\tinterface\tip_family\tprovider\tserver\tdownload_mbps\tupload_mbps\tlatency_ms\tjitter_ms\tmedian_ms\tp95_ms\tdownload_latency_ms\tupload_latency_ms\tbufferbloat\tproxy\terrors\n"
+
+		csvSingle = "2026-10-17T12:00:00Z,192.0.2.10,2001:db8::10,Москва,\"Example, Inc.\",64500,,,yandex,a.example,94.20,41.50,12.346,1.500,13.000,20.000,45.000,80.500,B,,\n"
+		csvIPv4   = "2026-10-17T12:00:00Z,192.0.2.10,2001:db8::10,Москва,\"Example, Inc.\",64500,,ipv4,yandex,a.example,94.20,41.50,12.346,1.500,13.000,20.000,45.000,80.500,B,,\n"
+		csvIPv6   = "2026-10-17T12:00:00Z,192.0.2.10,2001:db8::10,Москва,\"Example, Inc.\",64500,,ipv6,yandex,b.example:8443,512.25,,12.346,1.500,13.000,20.000,45.000,,B,socks5://proxy.example:1080,upload: connection refused\n"
+		csvNone   = "2026-10-17T12:00:00Z,,,,,,,,,,,,,,,,,,,,speed test: could not fetch probes\n"
+
+		tsvSingle = "2026-10-17T12:00:00Z\t192.0.2.10\t2001:db8::10\tМосква\tExample, Inc.\t64500\t\t\tyandex\ta.example\t94.20\t41.50\t12.346\t1.500\t13.000\t20.000\t45.000\t80.500\tB\t\t\n"
+		tsvIPv4   = "2026-10-17T12:00:00Z\t192.0.2.10\t2001:db8::10\tМосква\tExample, Inc.\t64500\t\tipv4\tyandex\ta.example\t94.20\t41.50\t12.346\t1.500\t13.000\t20.000\t45.000\t80.500\tB\t\t\n"
+		tsvIPv6   = "2026-10-17T12:00:00Z\t192.0.2.10\t2001:db8::10\tМосква\tExample, Inc.\t64500\t\tipv6\tyandex\tb.example:8443\t512.25\t\t12.346\t1.500\t13.000\t20.000\t45.000\t\tB\tsocks5://proxy.example:1080\tupload: connection refused\n"
+	)
+	reports := testReports()
+	for _, tc := range []struct {
+		format string
+		report string
+		header bool
+		want   string
+	}{
+		{"csv", "single", true, csvHeader + csvSingle},
+		{"csv", "single", false, csvSingle},
+		// one row per family, in family order whatever the map order
+		{"csv", "dual-stack", true, csvHeader + csvIPv4 + csvIPv6},
+		{"csv", "dual-stack", false, csvIPv4 + csvIPv6},
+		{"csv", "no speed test", false, csvNone},
+		{"tsv", "single", true, tsvHeader + tsvSingle},
+		{"tsv", "single", false, tsvSingle},
+		{"tsv", "dual-stack", true, tsvHeader + tsvIPv4 + tsvIPv6},
+		{"tsv", "dual-stack", false, tsvIPv4 + tsvIPv6},
+	} {
+		var buf bytes.Buffer
+		if err := formatters[tc.format](&buf, reports[tc.report], formatOptions{Header: tc.header}); err != nil {
+			t.Fatalf("%s %s: %v", tc.format, tc.report, err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("%s %s, header %v:\ngot:\n%s\nwant:\n%s", tc.format, tc.report, tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	reports := testReports()
+	for _, tc := range []struct {
+		report string
+		want   string
+	}{
+		{
+			report: "single",
+			want: `| Field | Value |
+|---|---|
+| time | 2026-10-17T12:00:00Z |
+| ipv4 | 192.0.2.10 |
+| ipv6 | 2001:db8::10 |
+| region | Москва |
+| isp | Example, Inc. |
+| asn | 64500 |
+| provider | yandex |
+| server | a.example |
+| download_mbps | 94.20 |
+| upload_mbps | 41.50 |
+| latency_ms | 12.346 |
+| jitter_ms | 1.500 |
+| median_ms | 13.000 |
+| p95_ms | 20.000 |
+| download_latency_ms | 45.000 |
+| upload_latency_ms | 80.500 |
+| bufferbloat | B |
+`,
+		},
+		{
+			report: "dual-stack",
+			want: `| Field | ipv4 | ipv6 |
+|---|---|---|
+| time | 2026-10-17T12:00:00Z | 2026-10-17T12:00:00Z |
+| ipv4 | 192.0.2.10 | 192.0.2.10 |
+| ipv6 | 2001:db8::10 | 2001:db8::10 |
+| region | Москва | Москва |
+| isp | Example, Inc. | Example, Inc. |
+| asn | 64500 | 64500 |
+| ip_family | ipv4 | ipv6 |
+| provider | yandex | yandex |
+| server | a.example | b.example:8443 |
+| download_mbps | 94.20 | 512.25 |
+| upload_mbps | 41.50 |  |
+| latency_ms | 12.346 | 12.346 |
+| jitter_ms | 1.500 | 1.500 |
+| median_ms | 13.000 | 13.000 |
+| p95_ms | 20.000 | 20.000 |
+| download_latency_ms | 45.000 | 45.000 |
+| upload_latency_ms | 80.500 |  |
+| bufferbloat | B | B |
+| proxy |  | socks5://proxy.example:1080 |
+| errors |  | upload: connection refused |
+`,
+		},
+		{
+			report: "no speed test",
+			want: `| Field | Value |
+|---|---|
+| time | 2026-10-17T12:00:00Z |
+| errors | speed test: could not fetch probes |
+`,
+		},
+	} {
+		var buf bytes.Buffer
+		if err := writeMarkdown(&buf, reports[tc.report], formatOptions{}); err != nil {
+			t.Fatalf("%s: %v", tc.report, err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tc.report, got, tc.want)
+		}
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	report := &yandex.Report{
+		SchemaVersion: 1,
+		ToolVersion:   "v1.2.3",
+		Time:          time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+		Network:       &yandex.NetworkInfo{IPv4: "192.0.2.10", ASN: 64500},
+		Errors:        []string{"speed test: could not fetch probes"},
+	}
+	// the keys and their order are the JSON ones
+	want := `schema_version: 1
+tool_version: v1.2.3
+time: "2026-10-17T12:00:00Z"
+network:
+  ipv4: 192.0.2.10
+  asn: 64500
+errors:
+- 'speed test: could not fetch probes'
+`
+	var buf bytes.Buffer
+	if err := writeYAML(&buf, report, formatOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Master290/internetometer-cli/pkg/yandex"
+)
+
+func saveReport(r *yandex.Report, path string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, trf("Failed to open log file: %v", err))
+		return
+	}
+	defer f.Close()
+	data, _ := json.Marshal(r)
+	f.WriteString(string(data) + "\n")
+}
+
+// textLabels are the labels of text output, translated and padded.
+func textLabels() map[string]string {
+	return yandex.Labels(language,
+		"Region", "ISP", "Download", "Upload", "Latency", "Jitter", "Spread",
+		"Setup", "Proxy", "DNS", "Loaded", "OS", "Time")
+}
+
+func printText(w io.Writer, r *yandex.Report, opts formatOptions) {
+	l := textLabels()
+	fmt.Fprintf(w, "--- %s ---\n", tr("Yandex Internetometer CLI"))
+	if n := r.Network; n != nil {
+		if n.IPv4 != "" {
+			fmt.Fprintf(w, "IPv4: %v\n", n.IPv4)
+		}
+		if n.IPv6 != "" {
+			fmt.Fprintf(w, "IPv6: %v\n", n.IPv6)
+		} else if n.IPv4 != "" {
+			fmt.Fprintln(w, "IPv6: -")
+		}
+
+		if n.Region != "" {
+			if s := r.Speed; s != nil && serverHost(s) != "" {
+				fmt.Fprintf(w, "%s%v (%v)\n", l["Region"], n.Region, serverHost(s))
+			} else {
+				fmt.Fprintf(w, "%s%v\n", l["Region"], n.Region)
+			}
+		}
+		if n.ISP != "" {
+			fmt.Fprintf(w, "%s%v (AS%v)\n", l["ISP"], n.ISP, n.ASN)
+		}
+	}
+
+	if s := r.Speed; s != nil {
+		printSpeed(w, s, opts.Unit, l)
+		if opts.Servers && s.Latency != nil && s.Latency.Hosts != nil {
+			printServers(w, s.Latency.Hosts)
+		}
+	}
+	if r.DualStack != nil {
+		printDualStack(w, r.DualStack, opts.Unit)
+	}
+
+	if r.System != nil {
+		fmt.Fprintf(w, "%s%v (%v)\n", l["OS"], r.System.OS, r.System.Arch)
+		fmt.Fprintf(w, "%s%v\n", l["Time"], r.Time.Format(time.RFC3339))
+	}
+}
+
+func printSpeed(w io.Writer, s *yandex.SpeedReport, unit yandex.SpeedUnit, l map[string]string) {
+	failed := tr("failed")
+	if d := s.Download; d != nil {
+		if d.Error != "" {
+			fmt.Fprintf(w, "%s%s: %v\n", l["Download"], failed, trErr(d.Error))
+		} else {
+			fmt.Fprintf(w, "%s%s\n", l["Download"], unit.Format(d.Mbps))
+			indent := strings.Repeat(" ", utf8.RuneCountInString(l["Download"]))
+			hosts := d.HostMbps()
+			for _, host := range slices.Sorted(maps.Keys(hosts)) {
+				fmt.Fprintf(w, "%s%s\n", indent, trf("%s from %s", unit.Format(hosts[host]), host))
+			}
+		}
+	}
+	if u := s.Upload; u != nil {
+		if u.Error != "" {
+			fmt.Fprintf(w, "%s%s: %v\n", l["Upload"], failed, trErr(u.Error))
+		} else {
+			fmt.Fprintf(w, "%s%s\n", l["Upload"], unit.Format(u.Mbps))
+		}
+	}
+	if lat := s.Latency; lat != nil {
+		if lat.Error != "" {
+			fmt.Fprintf(w, "%s%s: %v\n", l["Latency"], failed, trErr(lat.Error))
+		} else {
+			fmt.Fprintf(w, "%s%.0f ms\n", l["Latency"], lat.MinMs)
+			fmt.Fprintf(w, "%s%.1f ms (RFC 3550: %.1f ms)\n", l["Jitter"], lat.JitterMs, lat.RFC3550Jitter)
+			fmt.Fprintf(w, "%s%s %.1f / %s %.1f / %s %.1f / p95 %.1f / %s %.1f ms, %s %.1f ms\n", l["Spread"],
+				tr("min"), lat.MinMs, tr("mean"), lat.MeanMs, tr("median"), lat.MedianMs, lat.P95Ms,
+				tr("max"), lat.MaxMs, tr("stddev"), lat.StdDevMs)
+			fmt.Fprintf(w, "%s%v\n", l["Setup"], lat.Setup)
+		}
+	}
+	if len(s.Proxy) > 0 {
+		fmt.Fprintf(w, "%s%v\n", l["Proxy"], s.ProxyString())
+	}
+	if s.DNS != nil {
+		for _, lookup := range s.DNS.Lookups {
+			if lookup.Err != "" {
+				fmt.Fprintf(w, "%s%s %s: %s\n", l["DNS"], lookup.Host, failed, lookup.Err)
+				continue
+			}
+			fmt.Fprintf(w, "%s%s %.1f ms (%s)\n", l["DNS"], lookup.Host, durationMs(lookup.Duration), strings.Join(lookup.Addrs, ", "))
+		}
+	}
+	var loaded []string
+	if d := s.Download; d != nil && d.LoadedLatency != nil {
+		loaded = append(loaded, fmt.Sprintf("%.0f ms %s", durationMs(d.LoadedLatency.Median), tr("down")))
+	}
+	if u := s.Upload; u != nil && u.LoadedLatency != nil {
+		loaded = append(loaded, fmt.Sprintf("%.0f ms %s", durationMs(u.LoadedLatency.Median), tr("up")))
+	}
+	if len(loaded) > 0 {
+		line := strings.Join(loaded, " / ")
+		if s.Bufferbloat != nil {
+			line += trf(" (bufferbloat: %s)", s.Bufferbloat.Grade)
+		}
+		fmt.Fprintf(w, "%s%s\n", l["Loaded"], line)
+	}
+}
+
+func printServers(w io.Writer, hosts []yandex.HostLatency) {
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join([]string{tr("HOST"), tr("SAMPLES"), tr("MIN"), tr("MEDIAN"), tr("FAILURES"), tr("ERROR")}, "\t"))
+	for _, h := range hosts {
+		if len(h.Samples) == 0 {
+			fmt.Fprintf(tw, "%s\t0\t-\t-\t%d/%d\t%s\n", h.Host, h.Lost, h.Sent, h.Err)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.1f ms\t%.1f ms\t%d/%d\t%s\n",
+			h.Host, len(h.Samples), durationMs(h.Min), durationMs(h.Median), h.Lost, h.Sent, h.Err)
+	}
+	tw.Flush()
+}
+
+// printProbes lists the probes from get-probes, one per line.
+func printProbes(ctx context.Context, client *yandex.Client, asJSON bool) error {
+	probes, err := client.GetProbesContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		Kind string `json:"kind"`
+		Host string `json:"host"`
+		URL  string `json:"url"`
+	}
+	var list []entry
+	add := func(kind, rawURL string) {
+		host := rawURL
+		if u, err := url.Parse(rawURL); err == nil {
+			host = u.Host
+		}
+		list = append(list, entry{kind, host, rawURL})
+	}
+	for _, p := range probes.Latency.Probes {
+		add("latency", p.URL)
+	}
+	for _, p := range probes.Download.Probes {
+		add("download", p.URL)
+	}
+	for _, p := range probes.Upload.Probes {
+		add("upload", p.URL)
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(list)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join([]string{tr("KIND"), tr("HOST"), "URL"}, "\t"))
+	for _, e := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.Kind, e.Host, e.URL)
+	}
+	return w.Flush()
+}
+
+// printDualStack lays the IPv4 and IPv6 results out side by side.
+func printDualStack(w io.Writer, dual map[string]*yandex.SpeedReport, unit yandex.SpeedUnit) {
+	cell := func(s *yandex.SpeedReport, row string) string {
+		switch {
+		case s == nil:
+			return "-"
+		case s.Error != "":
+			return tr("failed") + ": " + trErr(s.Error)
+		}
+		switch row {
+		case "download", "upload":
+			t := s.Download
+			if row == "upload" {
+				t = s.Upload
+			}
+			if t == nil {
+				return "-"
+			}
+			if t.Error != "" {
+				return tr("failed") + ": " + trErr(t.Error)
+			}
+			return unit.Format(t.Mbps)
+		}
+		if s.Latency == nil {
+			return "-"
+		}
+		if s.Latency.Error != "" {
+			return tr("failed") + ": " + trErr(s.Latency.Error)
+		}
+		if row == "jitter" {
+			return fmt.Sprintf("%.1f ms", s.Latency.JitterMs)
+		}
+		return fmt.Sprintf("%.0f ms", s.Latency.MinMs)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "\tIPv4\tIPv6")
+	for _, row := range []struct{ label, key string }{
+		{tr("Download") + ":", "download"},
+		{tr("Upload") + ":", "upload"},
+		{tr("Latency") + ":", "latency"},
+		{tr("Jitter") + ":", "jitter"},
+	} {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", row.label, cell(dual["ipv4"], row.key), cell(dual["ipv6"], row.key))
+	}
+	tw.Flush()
+}
+
+// printPrometheus writes the report in the Prometheus text format. Failed
+// phases are left out instead of being reported as 0.
+func printPrometheus(w io.Writer, r *yandex.Report) {
+	labels := ""
+	if n := r.Network; n != nil {
+		if n.ISP != "" {
+			labels += fmt.Sprintf("isp=%q,", n.ISP)
+		}
+		if n.Region != "" {
+			labels += fmt.Sprintf("region=%q,", n.Region)
+		}
+	}
+	pairs := labels
+	if len(labels) > 0 {
+		labels = "{" + labels[:len(labels)-1] + "}"
+	}
+
+	if s := r.Speed; s != nil {
+		printSpeedMetrics(w, s, labels, pairs)
+	} else if r.DualStack == nil && len(r.Errors) > 0 {
+		// the speed test could not start, which scrapers must be able to
+		// tell apart from a test that was not asked for
+		fmt.Fprintln(w, "# HELP internetometer_phase_success Whether a speed test phase succeeded (1) or failed (0)")
+		fmt.Fprintln(w, "# TYPE internetometer_phase_success gauge")
+		for _, phase := range []string{"dns", "latency", "download", "upload"} {
+			fmt.Fprintf(w, "internetometer_phase_success{%sphase=%q} 0\n", pairs, phase)
+		}
+	}
+
+	if r.DualStack != nil {
+		for _, metric := range []struct {
+			name, help string
+			value      func(*yandex.SpeedReport) (float64, bool)
+		}{
+			{"internetometer_download_mbps", "Download speed in Mbps", func(s *yandex.SpeedReport) (float64, bool) {
+				return transferMbps(s.Download)
+			}},
+			{"internetometer_upload_mbps", "Upload speed in Mbps", func(s *yandex.SpeedReport) (float64, bool) {
+				return transferMbps(s.Upload)
+			}},
+			{"internetometer_latency_ms", "Network latency in milliseconds", func(s *yandex.SpeedReport) (float64, bool) {
+				if s.Latency == nil || s.Latency.Error != "" {
+					return 0, false
+				}
+				return s.Latency.MinMs, true
+			}},
+		} {
+			fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+			fmt.Fprintf(w, "# TYPE %s gauge\n", metric.name)
+			for _, family := range []string{"ipv4", "ipv6"} {
+				if s := r.DualStack[family]; s != nil && s.Error == "" {
+					if v, ok := metric.value(s); ok {
+						fmt.Fprintf(w, "%s{%sfamily=%q} %.2f\n", metric.name, pairs, family, v)
+					}
+				}
+			}
+		}
+	}
+}
+
+func transferMbps(t *yandex.TransferReport) (float64, bool) {
+	if t == nil || t.Error != "" {
+		return 0, false
+	}
+	return t.Mbps, true
+}
+
+// printSpeedMetrics writes the metrics of one speed test. labels is the
+// full label set, pairs the same labels to prepend to a metric's own.
+func printSpeedMetrics(w io.Writer, s *yandex.SpeedReport, labels, pairs string) {
+	if v, ok := transferMbps(s.Download); ok {
+		fmt.Fprintln(w, "# HELP internetometer_download_mbps Download speed in Mbps")
+		fmt.Fprintln(w, "# TYPE internetometer_download_mbps gauge")
+		fmt.Fprintf(w, "internetometer_download_mbps%s %.2f\n", labels, v)
+
+		if hosts := s.Download.HostMbps(); hosts != nil {
+			fmt.Fprintln(w, "# HELP internetometer_download_host_mbps Download speed per probe host in Mbps")
+			fmt.Fprintln(w, "# TYPE internetometer_download_host_mbps gauge")
+			for _, host := range slices.Sorted(maps.Keys(hosts)) {
+				fmt.Fprintf(w, "internetometer_download_host_mbps{%shost=%q} %.2f\n", pairs, host, hosts[host])
+			}
+		}
+	}
+
+	if v, ok := transferMbps(s.Upload); ok {
+		fmt.Fprintln(w, "# HELP internetometer_upload_mbps Upload speed in Mbps")
+		fmt.Fprintln(w, "# TYPE internetometer_upload_mbps gauge")
+		fmt.Fprintf(w, "internetometer_upload_mbps%s %.2f\n", labels, v)
+	}
+
+	if l := s.Latency; l != nil && l.Error == "" {
+		fmt.Fprintln(w, "# HELP internetometer_latency_ms Network latency in milliseconds")
+		fmt.Fprintln(w, "# TYPE internetometer_latency_ms gauge")
+		fmt.Fprintf(w, "internetometer_latency_ms%s %.3f\n", labels, l.MinMs)
+
+		fmt.Fprintln(w, "# HELP internetometer_latency_distribution_ms Distribution of the latency samples in milliseconds")
+		fmt.Fprintln(w, "# TYPE internetometer_latency_distribution_ms gauge")
+		for _, stat := range []struct {
+			name  string
+			value float64
+		}{
+			{"min", l.MinMs}, {"mean", l.MeanMs}, {"median", l.MedianMs}, {"p95", l.P95Ms},
+			{"max", l.MaxMs}, {"stddev", l.StdDevMs}, {"jitter", l.JitterMs}, {"jitter_rfc3550", l.RFC3550Jitter},
+		} {
+			fmt.Fprintf(w, "internetometer_latency_distribution_ms{%sstat=%q} %.3f\n", pairs, stat.name, stat.value)
+		}
+
+		fmt.Fprintln(w, "# HELP internetometer_setup_ms Time spent per stage of the first request to the latency host")
+		fmt.Fprintln(w, "# TYPE internetometer_setup_ms gauge")
+		for _, stage := range []struct {
+			name  string
+			value time.Duration
+		}{
+			{"dns", l.Setup.DNS}, {"connect", l.Setup.Connect}, {"tls", l.Setup.TLS}, {"ttfb", l.Setup.TTFB},
+		} {
+			fmt.Fprintf(w, "internetometer_setup_ms{%sstage=%q} %.3f\n", pairs, stage.name, durationMs(stage.value))
+		}
+	}
+
+	if s.DNS != nil {
+		fmt.Fprintln(w, "# HELP internetometer_dns_ms Time to resolve each probe host in milliseconds")
+		fmt.Fprintln(w, "# TYPE internetometer_dns_ms gauge")
+		for _, l := range s.DNS.Lookups {
+			if l.Err == "" {
+				fmt.Fprintf(w, "internetometer_dns_ms{%shost=%q} %.3f\n", pairs, l.Host, durationMs(l.Duration))
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP internetometer_phase_success Whether a speed test phase succeeded (1) or failed (0)")
+	fmt.Fprintln(w, "# TYPE internetometer_phase_success gauge")
+	phase := func(name, err string) {
+		success := 1
+		if err != "" {
+			success = 0
+		}
+		fmt.Fprintf(w, "internetometer_phase_success{%sphase=%q} %d\n", pairs, name, success)
+	}
+	if s.DNS != nil {
+		phase("dns", s.DNS.Error)
+	}
+	if s.Latency != nil {
+		phase("latency", s.Latency.Error)
+	}
+	if s.Download != nil {
+		phase("download", s.Download.Error)
+	}
+	if s.Upload != nil {
+		phase("upload", s.Upload.Error)
+	}
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
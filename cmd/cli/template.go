@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Master290/internetometer-cli/pkg/yandex"
+)
+
+// speedValue is a speed in megabits per second that prints in the unit
+// chosen with --unit.
+type speedValue struct {
+	mbps float64
+	unit yandex.SpeedUnit
+}
+
+func (v speedValue) String() string {
+	return v.unit.Format(v.mbps)
+}
+
+// templateData is what --template renders: the whole report, plus the
+// headline figures of a single speed test at the top level so that one-line
+// templates stay short. Figures that were not measured are zero.
+type templateData struct {
+	*yandex.Report
+
+	Download speedValue
+	Upload   speedValue
+	Latency  time.Duration
+	Jitter   time.Duration
+	Server   string
+}
+
+func newTemplateData(r *yandex.Report, unit yandex.SpeedUnit) templateData {
+	data := templateData{
+		Report:   r,
+		Download: speedValue{unit: unit},
+		Upload:   speedValue{unit: unit},
+	}
+	s := r.Speed
+	if s == nil {
+		return data
+	}
+	if v, ok := transferMbps(s.Download); ok {
+		data.Download.mbps = v
+	}
+	if v, ok := transferMbps(s.Upload); ok {
+		data.Upload.mbps = v
+	}
+	if l := s.Latency; l != nil && l.Error == "" {
+		data.Latency = l.Stats.Min
+		data.Jitter = l.Stats.Jitter
+	}
+	data.Server = serverHost(s)
+	return data
+}
+
+// templateFuncs are the helpers available to --template.
+var templateFuncs = template.FuncMap{
+	// bytes and ibytes humanize a byte count with decimal (kB, MB) or
+	// binary (KiB, MiB) prefixes.
+	"bytes":  func(n any) string { return humanizeBytes(toFloat(n), 1000, []string{"B", "kB", "MB", "GB", "TB"}) },
+	"ibytes": func(n any) string { return humanizeBytes(toFloat(n), 1024, []string{"B", "KiB", "MiB", "GiB", "TiB"}) },
+	// mbytes converts megabits per second to megabytes per second, speed
+	// prints megabits per second in the --unit.
+	"mbytes": func(n any) float64 { return toFloat(n) / 8 },
+	"speed":  yandex.UnitMbps.Format,
+	// duration prints a duration rounded to a tenth of a millisecond, ms
+	// gives it as a number of milliseconds.
+	"duration": func(d time.Duration) string { return d.Round(100 * time.Microsecond).String() },
+	"ms":       durationMs,
+}
+
+func toFloat(n any) float64 {
+	switch v := n.(type) {
+	case speedValue:
+		return v.mbps
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case time.Duration:
+		return float64(v)
+	}
+	return 0
+}
+
+func humanizeBytes(n, base float64, units []string) string {
+	i := 0
+	for n >= base && i < len(units)-1 {
+		n /= base
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// parseTemplate reads the --template text or, if it is empty, the
+// --template-file; it returns nil when neither was given.
+func parseTemplate(text, file string) (*template.Template, error) {
+	name := "template"
+	if text == "" {
+		if file == "" {
+			return nil, nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		text, name = string(data), filepath.Base(file)
+	}
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+// templateFormatter renders a report through tmpl, ending it with a newline
+// if the template does not.
+func templateFormatter(tmpl *template.Template) formatter {
+	return func(w io.Writer, r *yandex.Report, opts formatOptions) error {
+		tmpl.Funcs(template.FuncMap{"speed": opts.Unit.Format})
+		var b strings.Builder
+		if err := tmpl.Execute(&b, newTemplateData(r, opts.Unit)); err != nil {
+			return err
+		}
+		out := b.String()
+		if !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		_, err := io.WriteString(w, out)
+		return err
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Master290/internetometer-cli/cmd/prom/metrics"
@@ -18,6 +20,10 @@ func main() {
 
 	delayStr := flag.String("delay", "1h", "Delay between measurements (in time.Duration format)")
 	timeoutStr := flag.String("timeout", "60s", "Timeout for measurement operation")
+	baseURL := flag.String("base-url", "", "Internetometer base URL, e.g. a local mirror")
+	concurrencyStr := flag.String("concurrency", "1", "Parallel connections per measurement, or \"auto\"")
+	downloadServersStr := flag.String("download-servers", "1", "Probe hosts to spread the download over")
+	interfacesStr := flag.String("interfaces", "", "Comma-separated network interfaces to measure through one by one (default route if empty)")
 	flag.Parse()
 
 	if d, exists := os.LookupEnv("IM_DELAY"); exists {
@@ -28,6 +34,22 @@ func main() {
 		*timeoutStr = to
 	}
 
+	if u, exists := os.LookupEnv("IM_BASE_URL"); exists {
+		*baseURL = u
+	}
+
+	if c, exists := os.LookupEnv("IM_CONCURRENCY"); exists {
+		*concurrencyStr = c
+	}
+
+	if s, exists := os.LookupEnv("IM_DOWNLOAD_SERVERS"); exists {
+		*downloadServersStr = s
+	}
+
+	if i, exists := os.LookupEnv("IM_INTERFACES"); exists {
+		*interfacesStr = i
+	}
+
 	delay, err := time.ParseDuration(*delayStr)
 	if err != nil {
 		log.Fatal(err)
@@ -38,10 +60,37 @@ func main() {
 		log.Fatal(err)
 	}
 
-	client := yandex.NewClient(&yandex.Config{
-		Timeout:     timeout,
-		Concurrency: 1,
-	})
+	concurrency := yandex.ConcurrencyAuto
+	if *concurrencyStr != "auto" {
+		concurrency, err = strconv.Atoi(*concurrencyStr)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	downloadServers, err := strconv.Atoi(*downloadServersStr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// one client per interface, "" measuring through the default route
+	interfaces := []string{""}
+	if *interfacesStr != "" {
+		interfaces = strings.Split(*interfacesStr, ",")
+		for i := range interfaces {
+			interfaces[i] = strings.TrimSpace(interfaces[i])
+		}
+	}
+	clients := make(map[string]*yandex.Client)
+	for _, iface := range interfaces {
+		clients[iface] = yandex.NewClient(&yandex.Config{
+			BaseURL:         *baseURL,
+			Timeout:         timeout,
+			Concurrency:     concurrency,
+			DownloadServers: downloadServers,
+			Interface:       iface,
+		})
+	}
 
 	m := metrics.New()
 	prometheus.MustRegister(m)
@@ -49,13 +98,26 @@ func main() {
 	go func() {
 		ticker := time.NewTicker(delay)
 		for {
-			log.Println("Measuring Internet connectivity parameters.")
+			for _, iface := range interfaces {
+				client := clients[iface]
+				if iface == "" {
+					log.Printf("Measuring Internet connectivity parameters via %s.", client.Provider().Name())
+				} else {
+					log.Printf("Measuring Internet connectivity parameters via %s on %s.", client.Provider().Name(), iface)
+				}
 
-			speed, err := client.RunSpeedTest(context.TODO(), nil)
-			if err != nil {
-				log.Println(err)
-			} else {
-				m.Update(speed)
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				speed, err := client.RunSpeedTest(ctx, nil)
+				cancel()
+				if err != nil {
+					log.Println(err)
+					m.Fail(iface, err)
+				} else {
+					if err := speed.Err(); err != nil {
+						log.Println(err)
+					}
+					m.Update(iface, speed)
+				}
 			}
 
 			log.Println("Background cache updated.")
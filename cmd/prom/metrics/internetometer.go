@@ -1,7 +1,10 @@
 package metrics
 
 import (
+	"maps"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/Master290/internetometer-cli/pkg/yandex"
 	"github.com/prometheus/client_golang/prometheus"
@@ -10,11 +13,17 @@ import (
 type internetometer struct {
 	sync.RWMutex
 
-	pingMetric     *prometheus.Desc
-	uploadMetric   *prometheus.Desc
-	downloadMetric *prometheus.Desc
+	pingMetric         *prometheus.Desc
+	uploadMetric       *prometheus.Desc
+	downloadMetric     *prometheus.Desc
+	phaseSuccessMetric *prometheus.Desc
+	latencyMetric      *prometheus.Desc
+	downloadHostMetric *prometheus.Desc
+	dnsMetric          *prometheus.Desc
 
-	res yandex.SpeedResult
+	// results holds the last measurement per interface, "" standing for
+	// the default route.
+	results map[string]*yandex.SpeedResult
 }
 
 // Collect implements [prometheus.Collector].
@@ -22,23 +31,103 @@ func (i *internetometer) Collect(ch chan<- prometheus.Metric) {
 	i.RLock()
 	defer i.RUnlock()
 
-	ch <- prometheus.MustNewConstMetric(
-		i.pingMetric,
-		prometheus.GaugeValue,
-		float64(i.res.Latency.Milliseconds()),
-	)
-
-	ch <- prometheus.MustNewConstMetric(
-		i.uploadMetric,
-		prometheus.GaugeValue,
-		i.res.UploadMbps,
-	)
-
-	ch <- prometheus.MustNewConstMetric(
-		i.downloadMetric,
-		prometheus.GaugeValue,
-		i.res.DownloadMbps,
-	)
+	for _, iface := range slices.Sorted(maps.Keys(i.results)) {
+		i.collect(ch, iface, i.results[iface])
+	}
+}
+
+func (i *internetometer) collect(ch chan<- prometheus.Metric, iface string, res *yandex.SpeedResult) {
+	// A failed phase only reports phase_success 0, so that a real 0 Mb/s
+	// can be told apart from a measurement that never happened.
+	if res.LatencyErr == nil {
+		ch <- prometheus.MustNewConstMetric(
+			i.pingMetric,
+			prometheus.GaugeValue,
+			float64(res.Latency.Milliseconds()),
+			iface,
+		)
+
+		s := res.LatencyStats
+		for stat, d := range map[string]time.Duration{
+			"min":            s.Min,
+			"mean":           s.Avg,
+			"median":         s.Median,
+			"p95":            s.P95,
+			"max":            s.Max,
+			"stddev":         s.StdDev,
+			"jitter":         s.Jitter,
+			"jitter_rfc3550": s.RFC3550Jitter,
+		} {
+			ch <- prometheus.MustNewConstMetric(
+				i.latencyMetric,
+				prometheus.GaugeValue,
+				float64(d)/float64(time.Millisecond),
+				stat, iface,
+			)
+		}
+	}
+
+	if res.UploadErr == nil {
+		ch <- prometheus.MustNewConstMetric(
+			i.uploadMetric,
+			prometheus.GaugeValue,
+			res.UploadMbps,
+			iface,
+		)
+	}
+
+	if res.DownloadErr == nil {
+		ch <- prometheus.MustNewConstMetric(
+			i.downloadMetric,
+			prometheus.GaugeValue,
+			res.DownloadMbps,
+			iface,
+		)
+
+		if len(res.Download.Hosts) > 1 {
+			for _, h := range res.Download.Hosts {
+				ch <- prometheus.MustNewConstMetric(
+					i.downloadHostMetric,
+					prometheus.GaugeValue,
+					h.BitsPerSec/1000000.0,
+					h.Host, iface,
+				)
+			}
+		}
+	}
+
+	for _, l := range res.DNS {
+		if l.Err != "" {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			i.dnsMetric,
+			prometheus.GaugeValue,
+			float64(l.Duration)/float64(time.Millisecond),
+			l.Host, iface,
+		)
+	}
+
+	phases := map[string]error{
+		"latency":  res.LatencyErr,
+		"download": res.DownloadErr,
+		"upload":   res.UploadErr,
+	}
+	if res.Phases.Has(yandex.PhaseDNS) {
+		phases["dns"] = res.DNSErr
+	}
+	for phase, err := range phases {
+		success := 1.0
+		if err != nil {
+			success = 0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			i.phaseSuccessMetric,
+			prometheus.GaugeValue,
+			success,
+			phase, iface,
+		)
+	}
 }
 
 // Describe implements [prometheus.Collector].
@@ -46,32 +135,80 @@ func (i *internetometer) Describe(ch chan<- *prometheus.Desc) {
 	ch <- i.pingMetric
 	ch <- i.uploadMetric
 	ch <- i.downloadMetric
+	ch <- i.phaseSuccessMetric
+	ch <- i.latencyMetric
+	ch <- i.downloadHostMetric
+	ch <- i.dnsMetric
 }
 
-func (i *internetometer) Update(res *yandex.SpeedResult) {
+// Update records the last measurement taken through iface, "" for the
+// default route.
+func (i *internetometer) Update(iface string, res *yandex.SpeedResult) {
 	i.Lock()
 	defer i.Unlock()
 
-	i.res = *res
+	i.results[iface] = res
+}
+
+// Fail records a run through iface that failed before any phase could
+// start, e.g. because the probes could not be fetched, as one in which
+// every phase failed. The speeds of the previous run are dropped.
+func (i *internetometer) Fail(iface string, err error) {
+	failed := func(phase string) error {
+		return &yandex.PhaseError{Phase: phase, Err: err}
+	}
+	i.Update(iface, &yandex.SpeedResult{
+		Phases:      yandex.AllPhases,
+		DNSErr:      failed("dns"),
+		LatencyErr:  failed("latency"),
+		DownloadErr: failed("download"),
+		UploadErr:   failed("upload"),
+	})
 }
 
 func New() *internetometer {
 	return &internetometer{
+		results: make(map[string]*yandex.SpeedResult),
+
 		pingMetric: prometheus.NewDesc(
 			"internetometer_ping",
 			"Latency (ms)",
-			nil, nil,
+			[]string{"interface"}, nil,
 		),
 		uploadMetric: prometheus.NewDesc(
 			"internetometer_upload",
 			"Upload speed (Mb/s)",
-			nil, nil,
+			[]string{"interface"}, nil,
 		),
 
 		downloadMetric: prometheus.NewDesc(
 			"internetometer_download",
 			"Download speed (Mb/s)",
-			nil, nil,
+			[]string{"interface"}, nil,
+		),
+
+		phaseSuccessMetric: prometheus.NewDesc(
+			"internetometer_phase_success",
+			"Whether the last measurement phase succeeded (1) or failed (0)",
+			[]string{"phase", "interface"}, nil,
+		),
+
+		latencyMetric: prometheus.NewDesc(
+			"internetometer_latency_distribution_ms",
+			"Distribution of the latency samples (ms)",
+			[]string{"stat", "interface"}, nil,
+		),
+
+		downloadHostMetric: prometheus.NewDesc(
+			"internetometer_download_host",
+			"Download speed per probe host when spread over several (Mb/s)",
+			[]string{"host", "interface"}, nil,
+		),
+
+		dnsMetric: prometheus.NewDesc(
+			"internetometer_dns",
+			"Time to resolve each probe host (ms)",
+			[]string{"host", "interface"}, nil,
 		),
 	}
 }
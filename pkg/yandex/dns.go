@@ -0,0 +1,258 @@
+package yandex
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNSLookup is the resolution of one probe host.
+type DNSLookup struct {
+	Host     string        `json:"host"`
+	Addrs    []string      `json:"addrs"`
+	Duration time.Duration `json:"duration_ns"`
+	Err      string        `json:"error,omitempty"`
+}
+
+// resolver returns the resolver for Config.DNSServer, nil for the system
+// one.
+func (cfg *Config) resolver() (*net.Resolver, error) {
+	if cfg.DNSServer == "" {
+		return nil, nil
+	}
+
+	scheme, server, err := dnsServer(cfg.DNSServer)
+	if err != nil {
+		return nil, err
+	}
+	if scheme == "https" || scheme == "http" {
+		doh := &dohClient{url: server, httpClient: cfg.dohHTTPClient()}
+		return &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return &dohConn{ctx: ctx, client: doh}, nil
+			},
+		}, nil
+	}
+
+	// The Go resolver asks for "udp" first and retries over "tcp" when
+	// the answer was truncated; tcp:// sends everything over TCP.
+	dial := cfg.dialer(nil)
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			if scheme == "tcp" || !strings.HasPrefix(network, "udp") {
+				network = "tcp"
+			} else {
+				network = "udp"
+			}
+			return dial(ctx, network, server)
+		},
+	}, nil
+}
+
+// dnsServer splits a Config.DNSServer into its scheme and address. The
+// server is "host[:port]" or "udp://host[:port]" for plain DNS,
+// "tcp://host[:port]" for DNS over TCP and the URL of a DNS-over-HTTPS
+// endpoint. Plain DNS addresses come back with the port, 53 by default;
+// DoH ones are the whole URL.
+func dnsServer(s string) (scheme, addr string, err error) {
+	scheme, addr = "udp", s
+	if sc, rest, ok := strings.Cut(s, "://"); ok {
+		switch sc {
+		case "udp", "tcp":
+			scheme, addr = sc, rest
+		case "https", "http":
+			return sc, s, nil
+		default:
+			return "", "", fmt.Errorf("unsupported DNS server scheme %q", sc)
+		}
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	return scheme, addr, nil
+}
+
+// lookupHosts resolves every host once, in parallel, timing each lookup.
+func (c *Client) lookupHosts(ctx context.Context, hosts []string) []DNSLookup {
+	resolver, err := c.resolver, c.resolverErr
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	lookups := make([]DNSLookup, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		lookups[i].Host = host
+		if err != nil {
+			lookups[i].Err = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func(l *DNSLookup) {
+			defer wg.Done()
+			start := time.Now()
+			addrs, err := resolver.LookupIPAddr(ctx, l.Host)
+			l.Duration = time.Since(start)
+			if err != nil {
+				l.Err = err.Error()
+				return
+			}
+			for _, a := range addrs {
+				l.Addrs = append(l.Addrs, a.IP.String())
+			}
+		}(&lookups[i])
+	}
+	wg.Wait()
+	return lookups
+}
+
+// runDNS resolves the host names of every probe. IP literals need no
+// lookup and are left out.
+func (c *Client) runDNS(ctx context.Context, probes *ProbesResponse, result *SpeedResult) {
+	var hosts []string
+	add := func(rawURL string) {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil {
+			return
+		}
+		if !slices.Contains(hosts, u.Hostname()) {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+	for _, p := range probes.Latency.Probes {
+		add(p.URL)
+	}
+	for _, p := range probes.Download.Probes {
+		add(p.URL)
+	}
+	for _, p := range probes.Upload.Probes {
+		add(p.URL)
+	}
+	if len(hosts) == 0 {
+		return
+	}
+
+	result.DNS = c.lookupHosts(ctx, hosts)
+	var errs []error
+	for _, l := range result.DNS {
+		if l.Err == "" {
+			return
+		}
+		errs = append(errs, errors.New(l.Err))
+	}
+	result.DNSErr = &PhaseError{Phase: "dns", Err: errors.Join(errs...)}
+}
+
+// dohClient sends DNS messages to a DNS-over-HTTPS server (RFC 8484).
+type dohClient struct {
+	url        string
+	httpClient *http.Client
+}
+
+// dohHTTPClient is what DNS-over-HTTPS queries go through: the address
+// family, source address, proxy and timeout of the measurements, so that
+// they take the same path. The DoH host itself is found by the system
+// resolver.
+func (cfg *Config) dohHTTPClient() *http.Client {
+	dial := cfg.dialer(nil)
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			Proxy: cfg.proxyFunc(),
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dial(ctx, "tcp", addr)
+			},
+			ForceAttemptHTTP2:   true,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+func (d *dohClient) exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", d.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS over HTTPS: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+}
+
+// dohConn lets the Go resolver talk to a dohClient. It is not a
+// net.PacketConn, so the resolver frames messages as over TCP: a two-byte
+// length, then the message.
+type dohConn struct {
+	ctx    context.Context
+	client *dohClient
+
+	req  bytes.Buffer
+	resp bytes.Reader
+}
+
+func (c *dohConn) Write(p []byte) (int, error) {
+	c.req.Write(p)
+	return len(p), nil
+}
+
+func (c *dohConn) Read(p []byte) (int, error) {
+	if c.resp.Len() == 0 {
+		if err := c.roundTrip(); err != nil {
+			return 0, err
+		}
+	}
+	return c.resp.Read(p)
+}
+
+// roundTrip sends the buffered query and queues its framed answer.
+func (c *dohConn) roundTrip() error {
+	framed := c.req.Bytes()
+	if len(framed) < 2 || len(framed) < 2+int(binary.BigEndian.Uint16(framed)) {
+		return io.ErrUnexpectedEOF
+	}
+	n := int(binary.BigEndian.Uint16(framed))
+	answer, err := c.client.exchange(c.ctx, framed[2:2+n])
+	if err != nil {
+		return err
+	}
+	c.req.Next(2 + n)
+
+	out := make([]byte, 2+len(answer))
+	binary.BigEndian.PutUint16(out, uint16(len(answer)))
+	copy(out[2:], answer)
+	c.resp.Reset(out)
+	return nil
+}
+
+func (c *dohConn) Close() error                     { return nil }
+func (c *dohConn) LocalAddr() net.Addr              { return dohAddr{} }
+func (c *dohConn) RemoteAddr() net.Addr             { return dohAddr{} }
+func (c *dohConn) SetDeadline(time.Time) error      { return nil }
+func (c *dohConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(time.Time) error { return nil }
+
+type dohAddr struct{}
+
+func (dohAddr) Network() string { return "https" }
+func (dohAddr) String() string  { return "dns-over-https" }
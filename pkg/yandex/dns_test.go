@@ -0,0 +1,247 @@
+package yandex
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDNSServer(t *testing.T) {
+	for _, tc := range []struct {
+		server     string
+		wantScheme string
+		wantAddr   string
+		wantErr    bool
+	}{
+		{server: "192.0.2.53", wantScheme: "udp", wantAddr: "192.0.2.53:53"},
+		{server: "192.0.2.53:5353", wantScheme: "udp", wantAddr: "192.0.2.53:5353"},
+		{server: "2001:db8::53", wantScheme: "udp", wantAddr: "[2001:db8::53]:53"},
+		{server: "dns.example", wantScheme: "udp", wantAddr: "dns.example:53"},
+		{server: "udp://192.0.2.53", wantScheme: "udp", wantAddr: "192.0.2.53:53"},
+		{server: "tcp://192.0.2.53", wantScheme: "tcp", wantAddr: "192.0.2.53:53"},
+		{server: "tcp://[2001:db8::53]:5353", wantScheme: "tcp", wantAddr: "[2001:db8::53]:5353"},
+		{server: "https://dns.example/dns-query", wantScheme: "https", wantAddr: "https://dns.example/dns-query"},
+		{server: "tls://192.0.2.53", wantErr: true},
+	} {
+		scheme, addr, err := dnsServer(tc.server)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("dnsServer(%q) = %q, %q; want an error", tc.server, scheme, addr)
+			}
+			continue
+		}
+		if err != nil || scheme != tc.wantScheme || addr != tc.wantAddr {
+			t.Errorf("dnsServer(%q) = %q, %q, %v; want %q, %q", tc.server, scheme, addr, err, tc.wantScheme, tc.wantAddr)
+		}
+	}
+}
+
+func TestResolverBadScheme(t *testing.T) {
+	cfg := &Config{DNSServer: "tls://192.0.2.53"}
+	if r, err := cfg.resolver(); err == nil {
+		t.Fatalf("resolver = %v, want an error", r)
+	}
+}
+
+// dnsAnswer answers query with addr for A questions and nothing for the
+// rest; a truncated answer only has the header and question. It returns
+// nil for a query it cannot parse.
+func dnsAnswer(query []byte, addr net.IP, truncated bool) []byte {
+	end := 12
+	for end < len(query) && query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	end += 5
+	if end > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+
+	flags := uint16(0x8180) // response, recursion desired and available
+	var answers uint16
+	if truncated {
+		flags |= 0x0200
+	} else if qtype == 1 {
+		answers = 1
+	}
+	msg := binary.BigEndian.AppendUint16(nil, binary.BigEndian.Uint16(query))
+	msg = binary.BigEndian.AppendUint16(msg, flags)
+	msg = binary.BigEndian.AppendUint16(msg, 1)
+	msg = binary.BigEndian.AppendUint16(msg, answers)
+	msg = append(msg, 0, 0, 0, 0)
+	msg = append(msg, query[12:end]...)
+	if answers > 0 {
+		// the name points back at the question
+		msg = append(msg, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+		msg = append(msg, addr.To4()...)
+	}
+	return msg
+}
+
+func TestResolverDoH(t *testing.T) {
+	want := net.IPv4(192, 0, 2, 1)
+	var queries atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "not a DNS message", http.StatusBadRequest)
+			return
+		}
+		query, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		answer := dnsAnswer(query, want, false)
+		if answer == nil {
+			http.Error(w, "bad DNS query", http.StatusBadRequest)
+			return
+		}
+		queries.Add(1)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(answer)
+	}))
+	defer srv.Close()
+
+	cfg := &Config{DNSServer: srv.URL}
+	r, err := cfg.resolver()
+	if err != nil {
+		t.Fatalf("resolver: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := r.LookupIPAddr(ctx, "probe.test.")
+	if err != nil {
+		t.Fatalf("LookupIPAddr: %v", err)
+	}
+	if len(addrs) != 1 || !addrs[0].IP.Equal(want) {
+		t.Errorf("LookupIPAddr = %v, want [%v]", addrs, want)
+	}
+	if queries.Load() == 0 {
+		t.Error("the DoH server got no queries")
+	}
+}
+
+// plainDNSServer answers over UDP and TCP on the same port, with
+// truncated answers over UDP when truncate is set, and counts the
+// queries each way.
+type plainDNSServer struct {
+	addr     string
+	udp, tcp atomic.Int32
+}
+
+func newPlainDNSServer(t *testing.T, addr net.IP, truncate bool) *plainDNSServer {
+	t.Helper()
+	var (
+		ln net.Listener
+		pc net.PacketConn
+	)
+	// the UDP port may be taken even though the TCP one was free
+	for range 10 {
+		var err error
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pc, err = net.ListenPacket("udp", ln.Addr().String())
+		if err == nil {
+			break
+		}
+		ln.Close()
+		ln = nil
+	}
+	if ln == nil {
+		t.Fatal("no port free for both UDP and TCP")
+	}
+	t.Cleanup(func() {
+		ln.Close()
+		pc.Close()
+	})
+
+	s := &plainDNSServer{addr: ln.Addr().String()}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			s.udp.Add(1)
+			pc.WriteTo(dnsAnswer(buf[:n], addr, truncate), from)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					var size [2]byte
+					if _, err := io.ReadFull(conn, size[:]); err != nil {
+						return
+					}
+					query := make([]byte, binary.BigEndian.Uint16(size[:]))
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					s.tcp.Add(1)
+					answer := dnsAnswer(query, addr, false)
+					conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(answer))))
+					conn.Write(answer)
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func TestResolverPlain(t *testing.T) {
+	want := net.IPv4(192, 0, 2, 1)
+	for _, tc := range []struct {
+		name     string
+		scheme   string
+		truncate bool
+		wantUDP  bool
+		wantTCP  bool
+	}{
+		{name: "bare host:port", wantUDP: true},
+		{name: "udp", scheme: "udp://", wantUDP: true},
+		{name: "truncated over udp retries over tcp", scheme: "udp://", truncate: true, wantUDP: true, wantTCP: true},
+		{name: "tcp", scheme: "tcp://", wantTCP: true},
+		{name: "tcp with a truncating udp side", scheme: "tcp://", truncate: true, wantTCP: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newPlainDNSServer(t, want, tc.truncate)
+
+			cfg := &Config{DNSServer: tc.scheme + srv.addr, IPFamily: IPv4Only}
+			r, err := cfg.resolver()
+			if err != nil {
+				t.Fatalf("resolver: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			addrs, err := r.LookupIPAddr(ctx, "probe.test.")
+			if err != nil {
+				t.Fatalf("LookupIPAddr: %v", err)
+			}
+			if len(addrs) != 1 || !addrs[0].IP.Equal(want) {
+				t.Errorf("LookupIPAddr = %v, want [%v]", addrs, want)
+			}
+			if got := srv.udp.Load() > 0; got != tc.wantUDP {
+				t.Errorf("%d queries over UDP, want some: %v", srv.udp.Load(), tc.wantUDP)
+			}
+			if got := srv.tcp.Load() > 0; got != tc.wantTCP {
+				t.Errorf("%d queries over TCP, want some: %v", srv.tcp.Load(), tc.wantTCP)
+			}
+		})
+	}
+}
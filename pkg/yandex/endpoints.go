@@ -0,0 +1,61 @@
+package yandex
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Endpoints lists every URL the client talks to. Empty fields are derived
+// from Config.BaseURL, so pointing BaseURL at a mirror is usually enough;
+// IPv4, IPv6 and ISP live on other hosts and have to be set explicitly.
+type Endpoints struct {
+	Probes   string
+	IPv4     string
+	IPv6     string
+	DateTime string
+	Region   string
+	ISP      string
+
+	// Referer and Origin are sent with measurement requests, the probe
+	// hosts reject uploads without them.
+	Referer string
+	Origin  string
+}
+
+func defaultBaseURL(lang string) string {
+	if lang == "en" {
+		return "https://yandex.com/internet"
+	}
+	return "https://yandex.ru/internet"
+}
+
+func (e *Endpoints) fill(baseURL string) {
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	if e.Probes == "" {
+		e.Probes = baseURL + "/api/v0/get-probes"
+	}
+	if e.DateTime == "" {
+		e.DateTime = baseURL + "/api/v1/datetime"
+	}
+	if e.Region == "" {
+		e.Region = baseURL
+	}
+	if e.IPv4 == "" {
+		e.IPv4 = "https://ipv4-internet.yandex.net/api/v0/ip"
+	}
+	if e.IPv6 == "" {
+		e.IPv6 = "https://ipv6-internet.yandex.net/api/v0/ip"
+	}
+	if e.ISP == "" {
+		e.ISP = "http://ip-api.com/json/"
+	}
+	if e.Referer == "" {
+		e.Referer = baseURL
+	}
+	if e.Origin == "" {
+		if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+			e.Origin = u.Scheme + "://" + u.Host
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package yandex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+var (
+	ErrProbeFetch  = errors.New("probe fetch failed")
+	ErrNoProbes    = errors.New("no probes available")
+	ErrConnRefused = errors.New("all connections refused")
+	ErrThrottled   = errors.New("throttled by server")
+	ErrTimeout     = errors.New("timed out")
+	ErrNoData      = errors.New("zero bytes transferred")
+)
+
+// StatusError is a non-200 answer from a probe host.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is reports 403 answers as ErrThrottled, that is how the probe hosts
+// rate-limit clients.
+func (e *StatusError) Is(target error) bool {
+	return target == ErrThrottled && e.StatusCode == http.StatusForbidden
+}
+
+// PhaseError ties a measurement failure to the phase it happened in.
+type PhaseError struct {
+	Phase string // "dns", "latency", "download" or "upload"
+	Err   error
+}
+
+func (e *PhaseError) Error() string {
+	return e.Phase + " failed: " + e.Err.Error()
+}
+
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// transferErrors collects the reasons parallel workers gave up, so an
+// empty phase can be explained instead of reported as 0 Mbps.
+type transferErrors struct {
+	mu       sync.Mutex
+	status   error
+	conn     error
+	answered bool
+}
+
+// ok records a request the server answered with 200.
+func (t *transferErrors) ok() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.answered = true
+}
+
+func (t *transferErrors) record(err error) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		t.status = err
+	} else {
+		t.conn = err
+	}
+}
+
+// err explains a phase that moved total bytes before ctx, the caller's
+// context, ended. Phases that moved any data are considered successful,
+// unless every answer the server gave was an error status.
+func (t *transferErrors) err(ctx context.Context, total int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if total > 0 && (t.answered || t.status == nil) {
+		return nil
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case isTimeout(t.conn):
+		return fmt.Errorf("%w: %w", ErrTimeout, t.conn)
+	case t.status != nil:
+		return t.status
+	case t.conn != nil:
+		return fmt.Errorf("%w: %w", ErrConnRefused, t.conn)
+	}
+	return ErrNoData
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
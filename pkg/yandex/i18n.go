@@ -0,0 +1,124 @@
+package yandex
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Messages are keyed by their English text, so English needs no catalog
+// and a missing translation falls back to English.
+var (
+	messagesMu sync.RWMutex
+	messages   = map[string]map[string]string{
+		"ru": {
+			"Yandex Internetometer CLI": "Яндекс Интернетометр CLI",
+			"Error":                     "Ошибка",
+			"Region":                    "Регион",
+			"ISP":                       "Провайдер",
+			"Download":                  "Загрузка",
+			"Upload":                    "Отдача",
+			"Latency":                   "Задержка",
+			"Jitter":                    "Джиттер",
+			"Spread":                    "Разброс",
+			"Setup":                     "Соединение",
+			"Loaded":                    "Под нагрузкой",
+			"failed":                    "ошибка",
+			"down":                      "загрузка",
+			"up":                        "отдача",
+			"min":                       "мин",
+			"mean":                      "сред",
+			"median":                    "медиана",
+			"max":                       "макс",
+			"stddev":                    "ст. откл.",
+			" (bufferbloat: %s)":        " (раздувание буферов: %s)",
+
+			"probe fetch failed":      "не удалось получить список проб",
+			"no probes available":     "нет доступных проб",
+			"all connections refused": "все соединения отклонены",
+			"throttled by server":     "сервер ограничил скорость",
+			"timed out":               "превышено время ожидания",
+			"zero bytes transferred":  "не передано ни одного байта",
+
+			"Gathering information...":  "Сбор информации...",
+			"Measuring Latency...":      "Замер задержки...",
+			"Measuring Download":        "Замер загрузки",
+			"Measuring Upload":          "Замер отдачи",
+			"Results:":                  "Результаты:",
+			"Press q or Ctrl+C to quit": "Нажмите q или Ctrl+C для выхода",
+		},
+	}
+)
+
+// RegisterMessages adds translations of English messages to lang, so that
+// programs built on the package can put their own text in the catalog.
+func RegisterMessages(lang string, msgs map[string]string) {
+	messagesMu.Lock()
+	defer messagesMu.Unlock()
+
+	if messages[lang] == nil {
+		messages[lang] = make(map[string]string)
+	}
+	for k, v := range msgs {
+		messages[lang][k] = v
+	}
+}
+
+// Translate returns msg in lang, msg itself when there is no translation.
+func Translate(lang, msg string) string {
+	messagesMu.RLock()
+	defer messagesMu.RUnlock()
+
+	if t, ok := messages[lang][msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// Translatef translates format and then formats it like fmt.Sprintf.
+func Translatef(lang, format string, args ...any) string {
+	return fmt.Sprintf(Translate(lang, format), args...)
+}
+
+// TranslateError translates the messages of the package's errors, such as
+// ErrProbeFetch, wherever they appear in msg. What the system adds, like
+// the text of a network error, is left as is.
+func TranslateError(lang, msg string) string {
+	var pairs []string
+	for _, err := range []error{ErrProbeFetch, ErrNoProbes, ErrConnRefused, ErrThrottled, ErrTimeout, ErrNoData} {
+		pairs = append(pairs, err.Error(), Translate(lang, err.Error()))
+	}
+	return strings.NewReplacer(pairs...).Replace(msg)
+}
+
+// Labels translates labels and pads each, colon included, to the width of
+// the longest, so that the values printed after them line up.
+func Labels(lang string, labels ...string) map[string]string {
+	width := 0
+	for _, l := range labels {
+		width = max(width, utf8.RuneCountInString(Translate(lang, l)))
+	}
+	padded := make(map[string]string, len(labels))
+	for _, l := range labels {
+		padded[l] = fmt.Sprintf("%-*s", width+2, Translate(lang, l)+":")
+	}
+	return padded
+}
+
+// DetectLanguage picks "ru" or "en" from the locale in LC_ALL, LC_MESSAGES
+// or LANG, taken in that order as POSIX does.
+func DetectLanguage() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		locale := os.Getenv(env)
+		if locale == "" {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(locale), "ru") {
+			return "ru"
+		}
+		return "en"
+	}
+	return "en"
+}
@@ -1,25 +1,40 @@
 package yandex
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 )
 
 func (c *Client) GetIPv4() (string, error) {
+	return c.GetIPv4Context(context.Background())
+}
+
+func (c *Client) GetIPv4Context(ctx context.Context) (string, error) {
+	return c.provider.GetIPv4(ctx)
+}
+
+func (c *Client) GetIPv6() (string, error) {
+	return c.GetIPv6Context(context.Background())
+}
+
+func (c *Client) GetIPv6Context(ctx context.Context) (string, error) {
+	return c.provider.GetIPv6(ctx)
+}
+
+func (y *yandexProvider) GetIPv4(ctx context.Context) (string, error) {
 	var ip string
-	url := "https://ipv4-internet.yandex.net/api/v0/ip"
-	err := c.get(url, &ip)
+	err := y.get(ctx, y.config.Endpoints.IPv4, &ip)
 	if err != nil {
 		return "", fmt.Errorf("ipv4 detection failed: %w", err)
 	}
 	return ip, nil
 }
 
-func (c *Client) GetIPv6() (string, error) {
+func (y *yandexProvider) GetIPv6(ctx context.Context) (string, error) {
 	var ip string
-	url := "https://ipv6-internet.yandex.net/api/v0/ip"
-	err := c.get(url, &ip)
+	err := y.get(ctx, y.config.Endpoints.IPv6, &ip)
 	if err != nil {
 		// ipv6 might be missing, not an error
 		return "", nil
@@ -28,7 +43,11 @@ func (c *Client) GetIPv6() (string, error) {
 }
 
 func (c *Client) GetServerTime() (string, error) {
-	req, err := http.NewRequest("GET", "https://yandex.ru/internet/api/v1/datetime", nil)
+	return c.GetServerTimeContext(context.Background())
+}
+
+func (c *Client) GetServerTimeContext(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.config.Endpoints.DateTime, nil)
 	if err != nil {
 		return "", err
 	}
@@ -1,6 +1,7 @@
 package yandex
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 )
@@ -11,7 +12,11 @@ type ISPInfo struct {
 }
 
 func (c *Client) GetISP() (*ISPInfo, error) {
-	req, err := http.NewRequest("GET", "http://ip-api.com/json/", nil)
+	return c.GetISPContext(context.Background())
+}
+
+func (c *Client) GetISPContext(ctx context.Context) (*ISPInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.config.Endpoints.ISP, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,216 @@
+package yandex
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const loadedPingInterval = 200 * time.Millisecond
+
+// Timing breaks a single request down with net/http/httptrace. Stages a
+// request skipped, such as DNS and connect on a reused connection, stay
+// zero. TTFB runs from the request being written to the first response
+// byte, which on a warm connection is the round-trip time.
+type Timing struct {
+	DNS     time.Duration `json:"dns_ns"`
+	Connect time.Duration `json:"connect_ns"`
+	TLS     time.Duration `json:"tls_ns"`
+	TTFB    time.Duration `json:"ttfb_ns"`
+	Total   time.Duration `json:"total_ns"`
+	Reused  bool          `json:"reused"`
+}
+
+func (t Timing) String() string {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return fmt.Sprintf("DNS %.1f ms, connect %.1f ms, TLS %.1f ms, TTFB %.1f ms",
+		ms(t.DNS), ms(t.Connect), ms(t.TLS), ms(t.TTFB))
+}
+
+func (y *yandexProvider) Ping(ctx context.Context, probe Probe) (Timing, error) {
+	// Hooks may run concurrently and even after Do returns, e.g. for a
+	// dial that lost to a pooled connection, so t is only touched under mu.
+	var mu sync.Mutex
+	var t Timing
+	var dnsStart, connectStart, tlsStart, wrote time.Time
+	hook := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { hook(func() { dnsStart = time.Now() }) },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			hook(func() {
+				if !dnsStart.IsZero() {
+					t.DNS = time.Since(dnsStart)
+				}
+			})
+		},
+		ConnectStart: func(string, string) { hook(func() { connectStart = time.Now() }) },
+		ConnectDone: func(string, string, error) {
+			hook(func() {
+				if !connectStart.IsZero() {
+					t.Connect = time.Since(connectStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() { hook(func() { tlsStart = time.Now() }) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			hook(func() {
+				if !tlsStart.IsZero() {
+					t.TLS = time.Since(tlsStart)
+				}
+			})
+		},
+		GotConn:      func(info httptrace.GotConnInfo) { hook(func() { t.Reused = info.Reused }) },
+		WroteRequest: func(httptrace.WroteRequestInfo) { hook(func() { wrote = time.Now() }) },
+		GotFirstResponseByte: func() {
+			hook(func() {
+				if !wrote.IsZero() {
+					t.TTFB = time.Since(wrote)
+				}
+			})
+		},
+	}
+	timing := func() Timing {
+		mu.Lock()
+		defer mu.Unlock()
+		return t
+	}
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), "GET", probe.URL, nil)
+	if err != nil {
+		return timing(), err
+	}
+	req.Header.Set("User-Agent", y.config.UserAgent)
+	req.Header.Set("Referer", y.config.Endpoints.Referer)
+
+	resp, err := y.httpClient.Do(req)
+	if err != nil {
+		return timing(), err
+	}
+	// drained so the connection goes back to the pool for the next probe
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	result := timing()
+	result.Total = time.Since(start)
+
+	if resp.StatusCode != http.StatusOK {
+		return result, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return result, nil
+}
+
+// probeHost returns the host:port a probe URL connects to.
+func probeHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
+}
+
+// startLoadedLatency pings the latency probes in the background while a
+// transfer phase runs. The returned func stops probing and returns what
+// was collected; it is nil when loaded latency is not being measured.
+func (c *Client) startLoadedLatency(ctx context.Context, probes *ProbesResponse, result *SpeedResult) func() *LatencyStats {
+	var targets []Probe
+	for _, p := range probes.Latency.Probes {
+		if p.URL != "" {
+			targets = append(targets, p)
+		}
+	}
+	if !result.Phases.Has(PhaseLoadedLatency) || len(targets) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	var samples []time.Duration
+	sent := 0
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(loadedPingInterval)
+		defer ticker.Stop()
+
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			t, err := c.provider.Ping(ctx, targets[i%len(targets)])
+			if ctx.Err() != nil {
+				// cut short by the end of the phase, not lost
+				return
+			}
+			sent++
+			if err == nil {
+				samples = append(samples, t.TTFB)
+			}
+		}
+	}()
+
+	return func() *LatencyStats {
+		cancel()
+		wg.Wait()
+		return newLatencyStats(samples, sent)
+	}
+}
+
+// Bufferbloat compares latency under load with idle latency. Increases
+// are measured on the medians, the grade follows the worse direction.
+type Bufferbloat struct {
+	DownloadIncrease time.Duration `json:"download_increase_ns"`
+	UploadIncrease   time.Duration `json:"upload_increase_ns"`
+	Grade            string        `json:"grade,omitempty"`
+}
+
+func gradeBufferbloat(result *SpeedResult) Bufferbloat {
+	var b Bufferbloat
+	idle := result.LatencyStats.Median
+	if result.LatencyErr != nil || len(result.LatencyStats.Samples) == 0 {
+		return b
+	}
+
+	measured := false
+	if len(result.DownloadLatency.Samples) > 0 {
+		b.DownloadIncrease = max(result.DownloadLatency.Median-idle, 0)
+		measured = true
+	}
+	if len(result.UploadLatency.Samples) > 0 {
+		b.UploadIncrease = max(result.UploadLatency.Median-idle, 0)
+		measured = true
+	}
+	if !measured {
+		return b
+	}
+
+	worst := max(b.DownloadIncrease, b.UploadIncrease)
+	switch {
+	case worst < 5*time.Millisecond:
+		b.Grade = "A+"
+	case worst < 30*time.Millisecond:
+		b.Grade = "A"
+	case worst < 60*time.Millisecond:
+		b.Grade = "B"
+	case worst < 200*time.Millisecond:
+		b.Grade = "C"
+	case worst < 400*time.Millisecond:
+		b.Grade = "D"
+	default:
+		b.Grade = "F"
+	}
+	return b
+}
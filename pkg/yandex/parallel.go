@@ -5,172 +5,288 @@ import (
 	"io"
 	"net/http"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
-func (c *Client) measureDownloadParallel(ctx context.Context, url string, concurrency int, progress ProgressFunc) (float64, error) {
-	const targetDuration = 8 * time.Second
-	c.lastTestStart = time.Now()
-	start := c.lastTestStart
-	var totalRead int64
+const (
+	rampInterval = time.Second
+	rampGain     = 0.1
+)
+
+// transferFunc performs one request of a phase for worker c and reports
+// whether the worker should keep going.
+type transferFunc func(ctx context.Context, m *transferMeter, c *connMeter) bool
+
+// runTransfer runs do on parallel workers, handing them urls round-robin.
+func (y *yandexProvider) runTransfer(ctx context.Context, urls []string, concurrency int, do transferFunc) (*TransferStats, error) {
+	if len(urls) == 0 {
+		return nil, ErrNoProbes
+	}
+	targetDuration := y.config.phaseDuration()
+	meter := newTransferMeter(time.Now(), urls)
 
-	ctx, cancel := context.WithCancel(ctx)
+	phaseCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	done := make(chan struct{})
+	go meter.sample(done)
+
 	var wg sync.WaitGroup
-	for i := 0; i < concurrency; i++ {
+	running := 0
+	// rampUp is when the last streams were started; before it the phase
+	// ran with fewer streams than it ended with.
+	var rampUp time.Duration
+	start := func() {
+		running++
+		rampUp = time.Since(meter.start)
+		c := meter.conn()
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for {
 				select {
-				case <-ctx.Done():
+				case <-phaseCtx.Done():
 					return
 				default:
 				}
 
-				if time.Since(start) >= targetDuration {
-					return
-				}
-
-				req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-				if err != nil {
+				if time.Since(meter.start) >= targetDuration {
 					return
 				}
-				req.Header.Set("User-Agent", c.config.UserAgent)
-				req.Header.Set("Referer", "https://yandex.ru/")
 
-				resp, err := c.httpClient.Do(req)
-				if err != nil {
+				meter.request(c)
+				if !do(phaseCtx, meter, c) {
 					return
 				}
-				if resp == nil || resp.Body == nil {
-					return
-				}
-				if resp.StatusCode != http.StatusOK {
-					resp.Body.Close()
-					if resp.StatusCode == http.StatusForbidden {
-						time.Sleep(1 * time.Second)
-					}
-					continue
-				}
-
-				pr := &progressReader{
-					Reader: resp.Body,
-					OnRead: func(n int) {
-						newTotal := atomic.AddInt64(&totalRead, int64(n))
-						if progress != nil {
-							progress(ProgressReport{Bytes: newTotal, IsDownload: true})
-						}
-					},
-				}
-
-				n, _ := io.Copy(io.Discard, pr)
-				resp.Body.Close()
-				if n == 0 {
-					time.Sleep(200 * time.Millisecond)
-				}
 			}
 		}()
 	}
 
+	// In auto mode streams are doubled every rampInterval for as long as
+	// that still buys at least rampGain more throughput.
+	var ramp <-chan time.Time
+	rampEnd := meter.start
+	var lastBytes int64
+	var lastRate float64
+	if concurrency == ConcurrencyAuto {
+		start()
+		ticker := time.NewTicker(rampInterval)
+		defer ticker.Stop()
+		ramp = ticker.C
+	} else {
+		for i := 0; i < concurrency; i++ {
+			start()
+		}
+	}
+
 	timer := time.NewTimer(targetDuration)
 	defer timer.Stop()
 
-	select {
-	case <-timer.C:
-		cancel()
-	case <-ctx.Done():
+	var settle <-chan time.Time
+	if y.config.Adaptive {
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+		settle = ticker.C
+	}
+
+	stable := false
+wait:
+	for {
+		select {
+		case <-timer.C:
+			cancel()
+			break wait
+		case <-ramp:
+			total := meter.bytes()
+			rate := float64(total - lastBytes)
+			lastBytes = total
+			if (lastRate > 0 && rate < lastRate*(1+rampGain)) || running >= y.config.MaxConcurrency {
+				ramp = nil
+				rampEnd = time.Now()
+				meter.rampDone()
+				continue
+			}
+			lastRate = rate
+			for n := min(running, y.config.MaxConcurrency-running); n > 0; n-- {
+				start()
+			}
+		case <-settle:
+			// throughput cannot settle while streams are still being
+			// added, MinDuration counts from the end of the ramp-up
+			if ramp != nil || time.Since(rampEnd) < y.config.MinDuration {
+				continue
+			}
+			from := max(rampUp, y.config.Warmup)
+			if meter.stable(from, time.Second, y.config.StabilityThreshold) {
+				stable = true
+				cancel()
+				break wait
+			}
+		case <-phaseCtx.Done():
+			break wait
+		}
 	}
 
 	wg.Wait()
+	close(done)
 
-	duration := time.Since(start).Seconds()
-	bitsPerSec := (float64(totalRead) * 8) / duration
-	return bitsPerSec, nil
+	stats := meter.stats()
+	stats.Stable = stable
+	if concurrency == ConcurrencyAuto {
+		stats.RampUp = rampUp
+	}
+	return stats, meter.errs.err(ctx, meter.bytes())
 }
 
-func (c *Client) measureUploadParallel(ctx context.Context, url string, size int, concurrency int, progress ProgressFunc) (float64, error) {
-	const targetDuration = 8 * time.Second
-	c.lastTestStart = time.Now()
-	start := c.lastTestStart
-	var totalWritten int64
+func (y *yandexProvider) measureDownloadParallel(ctx context.Context, urls []string, concurrency int, progress ProgressFunc) (*TransferStats, error) {
+	return y.runTransfer(ctx, urls, concurrency, func(ctx context.Context, m *transferMeter, c *connMeter) bool {
+		req, err := http.NewRequestWithContext(ctx, "GET", c.url, nil)
+		if err != nil {
+			m.errs.record(err)
+			return false
+		}
+		req.Header.Set("User-Agent", y.config.UserAgent)
+		req.Header.Set("Referer", y.config.Endpoints.Referer)
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+		resp, err := y.httpClient.Do(req)
+		if err != nil {
+			m.errs.record(err)
+			return false
+		}
+		if resp == nil || resp.Body == nil {
+			return false
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			m.errs.record(&StatusError{StatusCode: resp.StatusCode})
+			if resp.StatusCode == http.StatusForbidden {
+				time.Sleep(1 * time.Second)
+			}
+			return true
+		}
 
-	var wg sync.WaitGroup
-	for i := 0; i < concurrency; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				default:
+		pr := &progressReader{
+			Reader: resp.Body,
+			OnRead: func(n int) {
+				newTotal := m.add(c, int64(n))
+				if progress != nil {
+					progress(ProgressReport{Bytes: newTotal, IsDownload: true})
 				}
+			},
+		}
 
-				if time.Since(start) >= targetDuration {
-					return
-				}
+		n, err := io.Copy(io.Discard, pr)
+		resp.Body.Close()
+		m.errs.ok()
+		m.errs.record(err)
+		if n == 0 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return true
+	})
+}
 
-				pw := &progressReader{
-					Reader: &io.LimitedReader{R: &nullReader{}, N: int64(size)},
-					OnRead: func(n int) {
-						newTotal := atomic.AddInt64(&totalWritten, int64(n))
-						if progress != nil {
-							progress(ProgressReport{Bytes: newTotal, IsDownload: false})
-						}
-					},
+func (y *yandexProvider) measureUploadParallel(ctx context.Context, url string, size int, concurrency int, progress ProgressFunc) (*TransferStats, error) {
+	return y.runTransfer(ctx, []string{url}, concurrency, func(ctx context.Context, m *transferMeter, c *connMeter) bool {
+		body := &uploadBody{
+			r: &io.LimitedReader{R: &nullReader{}, N: int64(size)},
+			onRead: func(n int) {
+				newTotal := m.add(c, int64(n))
+				if progress != nil {
+					progress(ProgressReport{Bytes: newTotal, IsDownload: false})
 				}
+			},
+			done: make(chan struct{}),
+		}
 
-				req, err := http.NewRequestWithContext(ctx, "POST", url, pw)
-				if err != nil {
-					return
-				}
-				req.Header.Set("User-Agent", c.config.UserAgent)
-				req.Header.Set("Referer", "https://yandex.ru/internet")
-				req.Header.Set("Origin", "https://yandex.ru")
-				req.Header.Set("Accept", "*/*")
-				req.Header.Set("Sec-Fetch-Mode", "cors")
-				req.Header.Set("Sec-Fetch-Site", "cross-site")
-				req.Header.Set("Sec-Fetch-Dest", "empty")
-				req.ContentLength = int64(size)
-
-				resp, err := c.httpClient.Do(req)
-				if err != nil {
-					return
-				}
-				if resp == nil {
-					return
-				}
-				if resp.Body == nil {
-					return
-				}
-				if resp.StatusCode != http.StatusOK {
-					resp.Body.Close()
-					time.Sleep(500 * time.Millisecond)
-					continue
-				}
-				resp.Body.Close()
+		req, err := http.NewRequestWithContext(ctx, "POST", c.url, body)
+		if err != nil {
+			m.errs.record(err)
+			return false
+		}
+		req.Header.Set("User-Agent", y.config.UserAgent)
+		req.Header.Set("Referer", y.config.Endpoints.Referer)
+		req.Header.Set("Origin", y.config.Endpoints.Origin)
+		req.Header.Set("Accept", "*/*")
+		req.Header.Set("Sec-Fetch-Mode", "cors")
+		req.Header.Set("Sec-Fetch-Site", "cross-site")
+		req.Header.Set("Sec-Fetch-Dest", "empty")
+		req.ContentLength = int64(size)
+
+		resp, err := y.httpClient.Do(req)
+		if err != nil {
+			// Bytes written before the connection broke were never
+			// confirmed by the server, unless the end of the phase cut
+			// the upload short.
+			if ctx.Err() == nil {
+				<-body.done
+				m.add(c, -body.bytes())
 			}
-		}()
-	}
+			m.errs.record(err)
+			return false
+		}
+		if resp == nil {
+			return false
+		}
+		if resp.Body == nil {
+			return false
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			// The server refused the body, it does not count. The
+			// transport may still be writing it when Do returns, so the
+			// bytes are taken back once it has closed the body.
+			<-body.done
+			m.add(c, -body.bytes())
+			m.errs.record(&StatusError{StatusCode: resp.StatusCode})
+			time.Sleep(500 * time.Millisecond)
+			return true
+		}
+		m.errs.ok()
+		return true
+	})
+}
 
-	timer := time.NewTimer(targetDuration)
-	defer timer.Stop()
+// uploadBody is the body of one upload request. It counts what the
+// transport reads from it and stops doing so once closed, which the
+// transport does when it is done with the request.
+type uploadBody struct {
+	r      io.Reader
+	onRead func(int)
+	done   chan struct{}
 
-	select {
-	case <-timer.C:
-		cancel()
-	case <-ctx.Done():
+	mu     sync.Mutex
+	sent   int64
+	closed bool
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, http.ErrBodyReadAfterClose
 	}
+	n, err := b.r.Read(p)
+	if n > 0 {
+		b.sent += int64(n)
+		b.onRead(n)
+	}
+	return n, err
+}
 
-	wg.Wait()
+func (b *uploadBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+	return nil
+}
 
-	duration := time.Since(start).Seconds()
-	bitsPerSec := (float64(totalWritten) * 8) / duration
-	return bitsPerSec, nil
+// bytes is what the transport has read so far.
+func (b *uploadBody) bytes() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sent
 }
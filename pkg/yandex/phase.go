@@ -0,0 +1,42 @@
+package yandex
+
+import "strings"
+
+// Phase is a set of speed test phases.
+type Phase uint8
+
+const (
+	PhaseLatency Phase = 1 << iota
+	PhaseDownload
+	PhaseUpload
+	// PhaseLoadedLatency keeps probing latency during download and upload.
+	PhaseLoadedLatency
+	// PhaseDNS times the resolution of every probe host.
+	PhaseDNS
+
+	AllPhases = PhaseLatency | PhaseDownload | PhaseUpload | PhaseLoadedLatency | PhaseDNS
+)
+
+// Has reports whether every phase in q is part of p.
+func (p Phase) Has(q Phase) bool {
+	return p&q == q
+}
+
+func (p Phase) String() string {
+	var names []string
+	for _, ph := range []struct {
+		phase Phase
+		name  string
+	}{
+		{PhaseLatency, "latency"},
+		{PhaseDownload, "download"},
+		{PhaseUpload, "upload"},
+		{PhaseLoadedLatency, "loaded_latency"},
+		{PhaseDNS, "dns"},
+	} {
+		if p.Has(ph.phase) {
+			names = append(names, ph.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,56 @@
+package yandex
+
+import (
+	"context"
+	"net/http"
+)
+
+// Provider is a speed-test backend. Client delegates probe discovery,
+// measurements and IP lookup to it, so the TUI, the CLI and the exporter
+// can run against Yandex or any compatible mirror without changes.
+type Provider interface {
+	// Name identifies the backend in logs and output.
+	Name() string
+
+	GetProbes(ctx context.Context) (*ProbesResponse, error)
+	MeasureLatency(ctx context.Context, probes []Probe) (*LatencyStats, error)
+	// Ping times a single request to a latency probe.
+	Ping(ctx context.Context, probe Probe) (Timing, error)
+	// MeasureDownload spreads its connections over urls round-robin.
+	MeasureDownload(ctx context.Context, urls []string, concurrency int, progress ProgressFunc) (*TransferStats, error)
+	MeasureUpload(ctx context.Context, url string, size int, concurrency int, progress ProgressFunc) (*TransferStats, error)
+
+	GetIPv4(ctx context.Context) (string, error)
+	GetIPv6(ctx context.Context) (string, error)
+}
+
+type yandexProvider struct {
+	httpClient *http.Client
+	config     *Config
+}
+
+// NewYandexProvider returns the Provider backed by the Yandex Internetometer API.
+func NewYandexProvider(httpClient *http.Client, cfg *Config) Provider {
+	return &yandexProvider{
+		httpClient: httpClient,
+		config:     cfg,
+	}
+}
+
+func (y *yandexProvider) Name() string {
+	return "yandex"
+}
+
+func (y *yandexProvider) MeasureLatency(ctx context.Context, probes []Probe) (*LatencyStats, error) {
+	return y.measureLatency(ctx, probes)
+}
+
+func (y *yandexProvider) MeasureDownload(ctx context.Context, urls []string, concurrency int, progress ProgressFunc) (*TransferStats, error) {
+	return y.measureDownloadParallel(ctx, urls, concurrency, progress)
+}
+
+func (y *yandexProvider) MeasureUpload(ctx context.Context, url string, size int, concurrency int, progress ProgressFunc) (*TransferStats, error) {
+	return y.measureUploadParallel(ctx, url, size, concurrency, progress)
+}
+
+var _ Provider = (*yandexProvider)(nil)
@@ -0,0 +1,80 @@
+package yandex
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// ProxyDirect in Config.Proxy sends every request directly, ignoring the
+// proxy environment variables.
+const ProxyDirect = "direct"
+
+// proxyFunc resolves Config.Proxy into the proxy selector of the
+// transport. HTTP proxies are reached with CONNECT for https targets,
+// SOCKS5 ones take their credentials from the URL.
+func (cfg *Config) proxyFunc() func(*http.Request) (*url.URL, error) {
+	switch cfg.Proxy {
+	case "":
+		return http.ProxyFromEnvironment
+	case ProxyDirect:
+		return nil
+	}
+
+	u, err := url.Parse(cfg.Proxy)
+	if err == nil {
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			err = fmt.Errorf("unsupported scheme %q", u.Scheme)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid proxy %q: %w", cfg.Proxy, err)
+		return func(*http.Request) (*url.URL, error) { return nil, err }
+	}
+	return http.ProxyURL(u)
+}
+
+// proxyLog remembers the proxy the requests to each host went through.
+type proxyLog struct {
+	mu    sync.Mutex
+	hosts map[string]string
+}
+
+// wrap records every decision of proxy, which may be nil for none.
+func (l *proxyLog) wrap(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		var u *url.URL
+		var err error
+		if proxy != nil {
+			u, err = proxy(req)
+		}
+		used := ProxyDirect
+		if u != nil {
+			used = u.Redacted()
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.hosts == nil {
+			l.hosts = make(map[string]string)
+		}
+		l.hosts[req.URL.Host] = used
+		return u, err
+	}
+}
+
+func (l *proxyLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clear(l.hosts)
+}
+
+func (l *proxyLog) snapshot() map[string]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return maps.Clone(l.hosts)
+}
@@ -1,6 +1,7 @@
 package yandex
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -8,12 +9,11 @@ import (
 )
 
 func (c *Client) GetRegion() (string, error) {
-	baseURL := "https://yandex.ru/internet"
-	if c.config.Language == "en" {
-		baseURL = "https://yandex.com/internet"
-	}
+	return c.GetRegionContext(context.Background())
+}
 
-	req, err := http.NewRequest("GET", baseURL, nil)
+func (c *Client) GetRegionContext(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.config.Endpoints.Region, nil)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,31 @@
+package yandex_test
+
+import (
+	"testing"
+
+	"github.com/Master290/internetometer-cli/pkg/yandex"
+	"github.com/Master290/internetometer-cli/pkg/yandex/yandextest"
+)
+
+func TestGetRegion(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts yandextest.Options
+		want string
+	}{
+		{"region page", yandextest.Options{Region: "Новосибирск"}, "Новосибирск"},
+		{"no region on the page", yandextest.Options{Status: map[string]int{yandextest.Region: 404}}, "Unknown"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, _ := newTestClient(t, tc.opts, yandex.AllPhases)
+
+			got, err := client.GetRegion()
+			if err != nil {
+				t.Fatalf("GetRegion: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("GetRegion = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package yandex
+
+import (
+	"errors"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ReportSchemaVersion is the version of the Report layout. It goes up
+// whenever a field is renamed, removed or changes meaning; adding fields
+// keeps it.
+const ReportSchemaVersion = 1
+
+// Version is the version of the tool, set at build time with
+//
+//	-ldflags "-X github.com/Master290/internetometer-cli/pkg/yandex.Version=v1.2.3"
+//
+// and otherwise taken from the module build info.
+var Version = ""
+
+// ToolVersion returns Version, falling back to the version Go recorded
+// for the main module and then to "dev".
+func ToolVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// Report is the result of one run of the tool, as written by every output
+// format and appended to the JSONL log. Sections that were not measured
+// are nil. Its JSON form is a stable contract described by SchemaVersion.
+type Report struct {
+	SchemaVersion int       `json:"schema_version"`
+	ToolVersion   string    `json:"tool_version"`
+	Time          time.Time `json:"time"`
+
+	Network *NetworkInfo `json:"network,omitempty"`
+	System  *SystemInfo  `json:"system,omitempty"`
+	Speed   *SpeedReport `json:"speed,omitempty"`
+
+	// DualStack holds one speed test per address family ("ipv4",
+	// "ipv6") when both were run, Speed is nil then.
+	DualStack map[string]*SpeedReport `json:"dual_stack,omitempty"`
+
+	// Errors lists what failed outside of the measurement phases, such
+	// as an IP lookup or a speed test that could not start.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// NewReport returns an empty report stamped with the schema and tool
+// versions and the current time.
+func NewReport() *Report {
+	return &Report{
+		SchemaVersion: ReportSchemaVersion,
+		ToolVersion:   ToolVersion(),
+		Time:          time.Now(),
+	}
+}
+
+// AddError records a failure outside of the measurement phases.
+func (r *Report) AddError(err error) {
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// NetworkInfo is what is known about the connection under test.
+type NetworkInfo struct {
+	IPv4      string `json:"ipv4,omitempty"`
+	IPv6      string `json:"ipv6,omitempty"`
+	Region    string `json:"region,omitempty"`
+	ISP       string `json:"isp,omitempty"`
+	ASN       int    `json:"asn,omitempty"`
+	Interface string `json:"interface,omitempty"`
+	SourceIP  string `json:"source_ip,omitempty"`
+}
+
+// SystemInfo describes the machine the tool ran on.
+type SystemInfo struct {
+	OS     string `json:"os"`
+	Arch   string `json:"arch"`
+	NumCPU int    `json:"num_cpu"`
+}
+
+// CurrentSystem describes the running machine.
+func CurrentSystem() *SystemInfo {
+	return &SystemInfo{
+		OS:     runtime.GOOS,
+		Arch:   runtime.GOARCH,
+		NumCPU: runtime.NumCPU(),
+	}
+}
+
+// SpeedReport is a SpeedResult laid out for output. Phases that did not
+// run are nil; a phase that failed has its Error set and no figures.
+type SpeedReport struct {
+	// Error is why the speed test could not run at all, in which case
+	// every phase is nil.
+	Error string `json:"error,omitempty"`
+
+	Provider string `json:"provider"`
+	Phases   string `json:"phases"`
+	IPFamily string `json:"ip_family,omitempty"`
+
+	DNS      *DNSReport      `json:"dns,omitempty"`
+	Latency  *LatencyReport  `json:"latency,omitempty"`
+	Download *TransferReport `json:"download,omitempty"`
+	Upload   *TransferReport `json:"upload,omitempty"`
+
+	// Bufferbloat compares loaded to idle latency, nil when loaded
+	// latency was not measured.
+	Bufferbloat *Bufferbloat `json:"bufferbloat,omitempty"`
+
+	// Proxy lists the proxies used (credentials masked), empty for a
+	// direct connection; Proxies maps every host to its proxy.
+	Proxy   []string          `json:"proxy,omitempty"`
+	Proxies map[string]string `json:"proxies,omitempty"`
+}
+
+// DNSReport is the DNS phase.
+type DNSReport struct {
+	Error   string      `json:"error,omitempty"`
+	Lookups []DNSLookup `json:"lookups"`
+}
+
+// LatencyReport is the latency phase, in milliseconds unless the field
+// name says otherwise.
+type LatencyReport struct {
+	Error string `json:"error,omitempty"`
+
+	// MinMs, the lowest sample, is the headline latency.
+	MinMs         float64 `json:"min_ms"`
+	MeanMs        float64 `json:"mean_ms"`
+	MedianMs      float64 `json:"median_ms"`
+	P95Ms         float64 `json:"p95_ms"`
+	MaxMs         float64 `json:"max_ms"`
+	StdDevMs      float64 `json:"stddev_ms"`
+	JitterMs      float64 `json:"jitter_ms"`
+	RFC3550Jitter float64 `json:"jitter_rfc3550_ms"`
+	Sent          int     `json:"sent"`
+	Lost          int     `json:"lost"`
+
+	// Setup breaks down the first request; Hosts is the per-host table.
+	Setup Timing        `json:"setup"`
+	Hosts []HostLatency `json:"hosts,omitempty"`
+	// Stats is what the figures above were taken from, left out of the
+	// JSON so that each of them appears once.
+	Stats LatencyStats `json:"-"`
+}
+
+// TransferReport is the download or upload phase.
+type TransferReport struct {
+	Error string `json:"error,omitempty"`
+
+	// Mbps is the reported speed, after warm-up and percentile, and
+	// BitsPerSec the same speed in the base unit.
+	Mbps       float64 `json:"mbps"`
+	BitsPerSec float64 `json:"bits_per_sec"`
+	// URLs are the probes the phase ran against.
+	URLs []string `json:"urls"`
+	// LoadedLatency is the latency measured while the phase ran, nil
+	// when it was not.
+	LoadedLatency *LatencyStats `json:"loaded_latency,omitempty"`
+	Stats         TransferStats `json:"stats"`
+}
+
+// HostMbps returns the throughput of each host the phase was spread
+// over, nil for a single host.
+func (t *TransferReport) HostMbps() map[string]float64 {
+	if len(t.Stats.Hosts) < 2 {
+		return nil
+	}
+	hosts := make(map[string]float64)
+	for _, h := range t.Stats.Hosts {
+		hosts[h.Host] = h.BitsPerSec / 1000000.0
+	}
+	return hosts
+}
+
+// NewSpeedReport lays res out for output; provider names the backend
+// that measured it.
+func NewSpeedReport(res *SpeedResult, provider string) *SpeedReport {
+	r := &SpeedReport{
+		Provider: provider,
+		Phases:   res.Phases.String(),
+		Proxies:  res.Proxies,
+	}
+	if res.IPFamily != IPAny {
+		r.IPFamily = res.IPFamily.String()
+	}
+	for _, p := range res.Proxies {
+		if p != ProxyDirect && !slices.Contains(r.Proxy, p) {
+			r.Proxy = append(r.Proxy, p)
+		}
+	}
+	slices.Sort(r.Proxy)
+
+	if res.Phases.Has(PhaseDNS) && len(res.DNS) > 0 {
+		r.DNS = &DNSReport{Error: phaseErr(res.DNSErr), Lookups: res.DNS}
+	}
+	if res.Phases.Has(PhaseLatency) {
+		r.Latency = newLatencyReport(res)
+	}
+	if res.Phases.Has(PhaseDownload) {
+		r.Download = &TransferReport{
+			Error: phaseErr(res.DownloadErr),
+			URLs:  res.DownloadURLs,
+			Stats: res.Download,
+		}
+		if res.DownloadErr == nil {
+			r.Download.Mbps = res.DownloadMbps
+			r.Download.BitsPerSec = res.DownloadMbps * 1000000.0
+		}
+		if len(res.DownloadLatency.Samples) > 0 {
+			r.Download.LoadedLatency = &res.DownloadLatency
+		}
+	}
+	if res.Phases.Has(PhaseUpload) {
+		r.Upload = &TransferReport{
+			Error: phaseErr(res.UploadErr),
+			Stats: res.Upload,
+		}
+		if res.UploadURL != "" {
+			r.Upload.URLs = []string{res.UploadURL}
+		}
+		if res.UploadErr == nil {
+			r.Upload.Mbps = res.UploadMbps
+			r.Upload.BitsPerSec = res.UploadMbps * 1000000.0
+		}
+		if len(res.UploadLatency.Samples) > 0 {
+			r.Upload.LoadedLatency = &res.UploadLatency
+		}
+	}
+	if res.Bufferbloat.Grade != "" {
+		bb := res.Bufferbloat
+		r.Bufferbloat = &bb
+	}
+	return r
+}
+
+func newLatencyReport(res *SpeedResult) *LatencyReport {
+	s := res.LatencyStats
+	r := &LatencyReport{
+		Error: phaseErr(res.LatencyErr),
+		Sent:  s.Sent,
+		Lost:  s.Lost,
+		Hosts: s.Hosts,
+		Stats: s,
+	}
+	if res.LatencyErr != nil {
+		return r
+	}
+	r.MinMs = durationMs(s.Min)
+	r.MeanMs = durationMs(s.Avg)
+	r.MedianMs = durationMs(s.Median)
+	r.P95Ms = durationMs(s.P95)
+	r.MaxMs = durationMs(s.Max)
+	r.StdDevMs = durationMs(s.StdDev)
+	r.JitterMs = durationMs(s.Jitter)
+	r.RFC3550Jitter = durationMs(s.RFC3550Jitter)
+	r.Setup = s.Setup
+	return r
+}
+
+// phaseErr is the reason a phase failed without the "<phase> failed"
+// prefix, which the report already conveys by its place.
+func phaseErr(err error) string {
+	if err == nil {
+		return ""
+	}
+	var pe *PhaseError
+	if errors.As(err, &pe) {
+		return pe.Err.Error()
+	}
+	return err.Error()
+}
+
+// ProxyString joins the proxies used, "" for a direct connection.
+func (r *SpeedReport) ProxyString() string {
+	return strings.Join(r.Proxy, ", ")
+}
@@ -0,0 +1,160 @@
+package yandex
+
+import (
+	"cmp"
+	"context"
+	"net/url"
+	"slices"
+)
+
+// Selection is how RunSpeedTest picks the download and upload hosts among
+// the probes returned by get-probes.
+type Selection uint8
+
+const (
+	// SelectDefault takes the 50mb download probe and the first upload
+	// probe, whatever host they are on.
+	SelectDefault Selection = iota
+	// SelectLowestLatency takes the probes of the host with the lowest
+	// median latency. Latency is measured for the ranking even when the
+	// latency phase is disabled.
+	SelectLowestLatency
+)
+
+func (s Selection) String() string {
+	if s == SelectLowestLatency {
+		return "latency"
+	}
+	return "default"
+}
+
+// hostMatches reports whether rawURL points at host, given either as
+// "name" or "name:port".
+func hostMatches(rawURL, host string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return u.Host == host || u.Hostname() == host
+}
+
+// filter returns a copy of p that only keeps the probes whose URL passes
+// keep.
+func (p *ProbesResponse) filter(keep func(rawURL string) bool) *ProbesResponse {
+	out := *p
+	out.Latency.Probes = nil
+	for _, probe := range p.Latency.Probes {
+		if keep(probe.URL) {
+			out.Latency.Probes = append(out.Latency.Probes, probe)
+		}
+	}
+	out.Download.Probes = nil
+	for _, probe := range p.Download.Probes {
+		if keep(probe.URL) {
+			out.Download.Probes = append(out.Download.Probes, probe)
+		}
+	}
+	out.Upload.Probes = p.Upload.Probes[:0:0]
+	for _, probe := range p.Upload.Probes {
+		if keep(probe.URL) {
+			out.Upload.Probes = append(out.Upload.Probes, probe)
+		}
+	}
+	return &out
+}
+
+// excludeHosts drops the probes on Config.ExcludeHosts.
+func (c *Client) excludeHosts(probes *ProbesResponse) *ProbesResponse {
+	if len(c.config.ExcludeHosts) == 0 {
+		return probes
+	}
+	return probes.filter(func(rawURL string) bool {
+		return !slices.ContainsFunc(c.config.ExcludeHosts, func(host string) bool {
+			return hostMatches(rawURL, host)
+		})
+	})
+}
+
+// rankTransferHosts lists the hosts to try for the transfer phases in
+// order of preference: Config.Server when pinned, the hosts by latency
+// under SelectLowestLatency, and nil when the default pick applies.
+func (c *Client) rankTransferHosts(ctx context.Context, probes *ProbesResponse, result *SpeedResult) []string {
+	if c.config.Server != "" {
+		return []string{c.config.Server}
+	}
+	if c.config.Selection != SelectLowestLatency {
+		return nil
+	}
+
+	hosts := result.LatencyStats.Hosts
+	if len(hosts) == 0 && len(probes.Latency.Probes) > 0 {
+		if stats, _ := c.provider.MeasureLatency(ctx, probes.Latency.Probes); stats != nil {
+			hosts = stats.Hosts
+		}
+	}
+	var answered []HostLatency
+	for _, h := range hosts {
+		if len(h.Samples) > 0 {
+			answered = append(answered, h)
+		}
+	}
+	slices.SortStableFunc(answered, func(a, b HostLatency) int {
+		return cmp.Compare(a.Median, b.Median)
+	})
+	names := make([]string, len(answered))
+	for i, h := range answered {
+		names[i] = h.Host
+	}
+	return names
+}
+
+// onFirstHost narrows probes down to the first of hosts that has probes
+// for the phase, as told by has. A pinned Config.Server is kept even
+// without probes so the phase fails instead of silently moving elsewhere;
+// otherwise probes are returned unchanged when no host qualifies.
+func (c *Client) onFirstHost(probes *ProbesResponse, hosts []string, has func(*ProbesResponse) bool) *ProbesResponse {
+	for _, host := range hosts {
+		onHost := probes.filter(func(rawURL string) bool {
+			return hostMatches(rawURL, host)
+		})
+		if has(onHost) || c.config.Server != "" {
+			return onHost
+		}
+	}
+	return probes
+}
+
+// downloadURLs picks the download probe of each host the download phase
+// should use: one host normally, up to Config.DownloadServers of them
+// when set and no host is pinned.
+func (c *Client) downloadURLs(probes *ProbesResponse, hosts []string) []string {
+	hasDownload := func(p *ProbesResponse) bool { return len(p.Download.Probes) > 0 }
+	if c.config.Server != "" || c.config.DownloadServers <= 1 {
+		if p := c.SelectDownloadProbe(c.onFirstHost(probes, hosts, hasDownload)); p != nil {
+			return []string{p.URL}
+		}
+		return nil
+	}
+
+	order := slices.Clone(hosts)
+	for _, p := range probes.Download.Probes {
+		if host := probeHost(p.URL); p.URL != "" && !slices.Contains(order, host) {
+			order = append(order, host)
+		}
+	}
+	var urls []string
+	for _, host := range order {
+		onHost := probes.filter(func(rawURL string) bool {
+			return hostMatches(rawURL, host)
+		})
+		p := c.SelectDownloadProbe(onHost)
+		if p == nil || p.URL == "" || slices.Contains(urls, p.URL) {
+			continue
+		}
+		urls = append(urls, p.URL)
+		if len(urls) == c.config.DownloadServers {
+			break
+		}
+	}
+	return urls
+}
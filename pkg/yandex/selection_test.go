@@ -0,0 +1,189 @@
+package yandex
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// probesOn lays out get-probes with a latency probe, a 100kb and a 50mb
+// download probe and an upload probe on each host.
+func probesOn(hosts ...string) *ProbesResponse {
+	p := &ProbesResponse{}
+	for _, host := range hosts {
+		base := "https://" + host + "/"
+		p.Latency.Probes = append(p.Latency.Probes, Probe{URL: base + "ping"})
+		p.Download.Probes = append(p.Download.Probes, Probe{URL: base + "100kb"}, Probe{URL: base + "50mb"})
+		p.Upload.Probes = append(p.Upload.Probes, struct {
+			Size int    `json:"size"`
+			URL  string `json:"url"`
+		}{Size: 10 << 20, URL: base + "upload"})
+	}
+	return p
+}
+
+// probeURLs lists every probe URL of p, latency, download and upload.
+func probeURLs(p *ProbesResponse) []string {
+	var urls []string
+	for _, probe := range p.Latency.Probes {
+		urls = append(urls, probe.URL)
+	}
+	for _, probe := range p.Download.Probes {
+		urls = append(urls, probe.URL)
+	}
+	for _, probe := range p.Upload.Probes {
+		urls = append(urls, probe.URL)
+	}
+	return urls
+}
+
+func TestExcludeHosts(t *testing.T) {
+	probes := probesOn("a.example", "b.example:8443", "c.example")
+
+	c := &Client{config: &Config{}}
+	if got := c.excludeHosts(probes); got != probes {
+		t.Errorf("excludeHosts without ExcludeHosts copied the probes")
+	}
+
+	c.config.ExcludeHosts = []string{"a.example", "b.example"}
+	got := probeURLs(c.excludeHosts(probes))
+	want := probeURLs(probesOn("c.example"))
+	if !slices.Equal(got, want) {
+		t.Errorf("excludeHosts = %v, want %v", got, want)
+	}
+	if len(probes.Download.Probes) != 6 {
+		t.Errorf("excludeHosts changed its argument: %d download probes left", len(probes.Download.Probes))
+	}
+}
+
+func TestRankTransferHosts(t *testing.T) {
+	ms := func(v time.Duration) []time.Duration { return []time.Duration{v * time.Millisecond} }
+	measured := []HostLatency{
+		{Host: "a.example", Median: 30 * time.Millisecond, Samples: ms(30)},
+		{Host: "b.example", Median: 10 * time.Millisecond, Samples: ms(10)},
+		{Host: "c.example", Err: "connection refused"},
+		{Host: "d.example", Median: 20 * time.Millisecond, Samples: ms(20)},
+	}
+	for _, tc := range []struct {
+		name   string
+		config Config
+		hosts  []HostLatency
+		want   []string
+	}{
+		{"default pick", Config{}, measured, nil},
+		{"pinned server", Config{Server: "z.example", Selection: SelectLowestLatency}, measured, []string{"z.example"}},
+		{"by median latency", Config{Selection: SelectLowestLatency}, measured, []string{"b.example", "d.example", "a.example"}},
+		// empty rather than nil: the default pick does not apply either
+		{"nothing answered", Config{Selection: SelectLowestLatency}, measured[2:3], []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Client{config: &tc.config}
+			result := &SpeedResult{LatencyStats: LatencyStats{Hosts: tc.hosts}}
+			got := c.rankTransferHosts(context.Background(), probesOn("a.example"), result)
+			if !slices.Equal(got, tc.want) || (got == nil) != (tc.want == nil) {
+				t.Errorf("rankTransferHosts = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOnFirstHost(t *testing.T) {
+	probes := probesOn("a.example", "b.example")
+	probes.Upload.Probes = probes.Upload.Probes[:1]
+	hasUpload := func(p *ProbesResponse) bool { return len(p.Upload.Probes) > 0 }
+
+	for _, tc := range []struct {
+		name   string
+		server string
+		hosts  []string
+		want   []string
+	}{
+		{"first host with probes", "", []string{"b.example", "a.example"}, []string{"https://a.example/upload"}},
+		{"no ranking", "", nil, []string{"https://a.example/upload"}},
+		{"unknown hosts fall back to every probe", "", []string{"z.example"}, []string{"https://a.example/upload"}},
+		{"pinned server", "b.example", []string{"b.example"}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Client{config: &Config{Server: tc.server}}
+			got := c.onFirstHost(probes, tc.hosts, hasUpload)
+			var urls []string
+			for _, p := range got.Upload.Probes {
+				urls = append(urls, p.URL)
+			}
+			if !slices.Equal(urls, tc.want) {
+				t.Errorf("upload probes = %v, want %v", urls, tc.want)
+			}
+		})
+	}
+}
+
+func TestDownloadURLs(t *testing.T) {
+	probes := probesOn("a.example", "b.example:8443", "c.example", "d.example")
+	for _, tc := range []struct {
+		name   string
+		config Config
+		probes *ProbesResponse
+		hosts  []string
+		want   []string
+	}{
+		{
+			name:   "default pick",
+			probes: probes,
+			want:   []string{"https://a.example/50mb"},
+		},
+		{
+			name:   "best ranked host",
+			probes: probes,
+			hosts:  []string{"c.example", "a.example"},
+			want:   []string{"https://c.example/50mb"},
+		},
+		{
+			name:   "pinned server without probes",
+			config: Config{Server: "z.example"},
+			probes: probes,
+			hosts:  []string{"z.example"},
+			want:   nil,
+		},
+		{
+			name:   "pinned server ignores DownloadServers",
+			config: Config{Server: "c.example", DownloadServers: 3},
+			probes: probes,
+			hosts:  []string{"c.example"},
+			want:   []string{"https://c.example/50mb"},
+		},
+		{
+			name:   "single host",
+			config: Config{DownloadServers: 3},
+			probes: probesOn("a.example"),
+			want:   []string{"https://a.example/50mb"},
+		},
+		{
+			name:   "ranked hosts first, then the rest in probe order",
+			config: Config{DownloadServers: 3},
+			probes: probes,
+			hosts:  []string{"d.example"},
+			want:   []string{"https://d.example/50mb", "https://a.example/50mb", "https://b.example:8443/50mb"},
+		},
+		{
+			name:   "the same probe only once",
+			config: Config{DownloadServers: 3},
+			probes: probes,
+			hosts:  []string{"b.example", "b.example:8443", "d.example"},
+			want:   []string{"https://b.example:8443/50mb", "https://d.example/50mb", "https://a.example/50mb"},
+		},
+		{
+			name:   "more servers than hosts",
+			config: Config{DownloadServers: 8},
+			probes: probesOn("a.example", "b.example"),
+			want:   []string{"https://a.example/50mb", "https://b.example/50mb"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Client{config: &tc.config}
+			if got := c.downloadURLs(tc.probes, tc.hosts); !slices.Equal(got, tc.want) {
+				t.Errorf("downloadURLs = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -2,19 +2,26 @@ package yandex
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"regexp"
 	"time"
 )
 
 func (c *Client) GetProbes() (*ProbesResponse, error) {
+	return c.GetProbesContext(context.Background())
+}
+
+func (c *Client) GetProbesContext(ctx context.Context) (*ProbesResponse, error) {
+	return c.provider.GetProbes(ctx)
+}
+
+func (y *yandexProvider) GetProbes(ctx context.Context) (*ProbesResponse, error) {
 	var resp ProbesResponse
-	url := "https://yandex.ru/internet/api/v0/get-probes"
-	err := c.get(url, &resp)
+	err := y.get(ctx, y.config.Endpoints.Probes, &resp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get probes: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrProbeFetch, err)
 	}
 	return &resp, nil
 }
@@ -24,6 +31,45 @@ type SpeedResult struct {
 	UploadMbps   float64
 	Latency      time.Duration
 	TestURL      string
+	UploadURL    string
+	// DownloadURLs lists every probe the download was spread over,
+	// TestURL being the first of them.
+	DownloadURLs []string
+
+	// Phases lists the phases that were run, the others are left zero.
+	Phases Phase
+	// IPFamily is the address family the test was restricted to.
+	IPFamily IPFamily
+	// Proxies maps every host the test reached to the proxy its requests
+	// went through (credentials masked), or ProxyDirect.
+	Proxies map[string]string
+
+	// Details behind the headline numbers above.
+	LatencyStats LatencyStats
+	Download     TransferStats
+	Upload       TransferStats
+
+	// Latency measured while the download and upload were running, and
+	// how it compares to LatencyStats.
+	DownloadLatency LatencyStats
+	UploadLatency   LatencyStats
+	Bufferbloat     Bufferbloat
+
+	// DNS lists the resolution of every probe host.
+	DNS []DNSLookup
+
+	// Per-phase failures as *PhaseError, nil when the phase succeeded.
+	// A failed phase leaves its measurement at zero; DNSErr is only set
+	// when no host resolved.
+	DNSErr      error
+	LatencyErr  error
+	DownloadErr error
+	UploadErr   error
+}
+
+// Err joins the per-phase failures, nil when every phase succeeded.
+func (r *SpeedResult) Err() error {
+	return errors.Join(r.DNSErr, r.LatencyErr, r.DownloadErr, r.UploadErr)
 }
 
 type ProgressReport struct {
@@ -61,160 +107,184 @@ func (c *Client) SelectUploadURL(probes *ProbesResponse) string {
 }
 
 func (c *Client) RunSpeedTest(ctx context.Context, progress ProgressFunc) (*SpeedResult, error) {
-	probes, err := c.GetProbes()
+	c.proxies.reset()
+	probes, err := c.GetProbesContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	result := &SpeedResult{}
+	probes = c.excludeHosts(probes)
+	result := &SpeedResult{Phases: c.config.Phases, IPFamily: c.config.IPFamily}
 
-	// latency
-	if len(probes.Latency.Probes) > 0 {
-		latency, err := c.measureLatency(ctx, probes.Latency.Probes)
-		if err == nil {
-			result.Latency = latency
-		}
+	warmup := c.config.Warmup
+	if warmup == WarmupFromProbes {
+		warmup = time.Duration(probes.Upload.Warmup.Duration) * time.Millisecond
 	}
 
-	// download
-	targetProbe := c.SelectDownloadProbe(probes)
-	if targetProbe != nil {
-		result.TestURL = targetProbe.URL
-		c.lastTestStart = time.Now()
-		bitsPerSec, err := c.measureDownloadParallel(ctx, targetProbe.URL, c.config.Concurrency, progress)
-		if err == nil {
-			result.DownloadMbps = bitsPerSec / 1000000.0
-		}
+	if result.Phases.Has(PhaseDNS) {
+		c.runDNS(ctx, probes, result)
 	}
-
-	// upload
-	targetURL := c.SelectUploadURL(probes)
-	if targetURL != "" {
-		c.lastTestStart = time.Now()
-		bitsPerSec, err := c.measureUploadParallel(ctx, targetURL, 50*1024*1024, c.config.Concurrency, progress)
-		if err == nil {
-			result.UploadMbps = bitsPerSec / 1000000.0
-		}
+	if result.Phases.Has(PhaseLatency) {
+		c.runLatency(ctx, probes, result)
+	}
+	var hosts []string
+	if result.Phases&(PhaseDownload|PhaseUpload) != 0 {
+		hosts = c.rankTransferHosts(ctx, probes, result)
+	}
+	if result.Phases.Has(PhaseDownload) {
+		c.runDownload(ctx, c.downloadURLs(probes, hosts), probes, warmup, progress, result)
 	}
+	if result.Phases.Has(PhaseUpload) {
+		target := c.onFirstHost(probes, hosts, func(p *ProbesResponse) bool { return len(p.Upload.Probes) > 0 })
+		c.runUpload(ctx, target, probes, warmup, progress, result)
+	}
+	result.Bufferbloat = gradeBufferbloat(result)
+	result.Proxies = c.proxies.snapshot()
 
 	return result, nil
 }
 
-func (c *Client) measureLatency(ctx context.Context, probes []Probe) (time.Duration, error) {
-	const count = 3
-	var min time.Duration = 10 * time.Second
-	found := false
-
-	for i := 0; i < count; i++ {
-		for _, p := range probes {
-			if p.URL == "" {
-				continue
-			}
-			start := time.Now()
-			req, err := http.NewRequestWithContext(ctx, "GET", p.URL, nil)
-			if err != nil {
-				continue
-			}
-			req.Header.Set("User-Agent", c.config.UserAgent)
-			req.Header.Set("Referer", "https://yandex.ru/internet")
+func (c *Client) runLatency(ctx context.Context, probes *ProbesResponse, result *SpeedResult) {
+	if len(probes.Latency.Probes) == 0 {
+		result.LatencyErr = &PhaseError{Phase: "latency", Err: ErrNoProbes}
+		return
+	}
+	stats, err := c.provider.MeasureLatency(ctx, probes.Latency.Probes)
+	if stats != nil {
+		result.LatencyStats = *stats
+	}
+	if err != nil {
+		result.LatencyErr = &PhaseError{Phase: "latency", Err: err}
+		return
+	}
+	result.Latency = stats.Min
+}
 
-			resp, err := c.httpClient.Do(req)
-			if err != nil {
-				continue
-			}
-			if resp.StatusCode == http.StatusOK {
-				dur := time.Since(start)
-				if dur < min {
-					min = dur
-				}
-				found = true
-			}
-			resp.Body.Close()
-		}
+// runDownload measures against urls; probes holds the latency probes used
+// for loaded latency.
+func (c *Client) runDownload(ctx context.Context, urls []string, probes *ProbesResponse, warmup time.Duration, progress ProgressFunc, result *SpeedResult) {
+	if len(urls) == 0 {
+		result.DownloadErr = &PhaseError{Phase: "download", Err: ErrNoProbes}
+		return
+	}
+	result.TestURL = urls[0]
+	result.DownloadURLs = urls
+	loaded := c.startLoadedLatency(ctx, probes, result)
+	// every host gets at least one connection
+	concurrency := c.config.Concurrency
+	if concurrency != ConcurrencyAuto {
+		concurrency = max(concurrency, len(urls))
 	}
-	if !found {
-		return 0, fmt.Errorf("no successful latency probes")
+	stats, err := c.provider.MeasureDownload(ctx, urls, concurrency, progress)
+	if stats != nil {
+		result.Download = *stats
 	}
-	return min, nil
+	if loaded != nil {
+		result.DownloadLatency = *loaded()
+	}
+	if err != nil {
+		result.DownloadErr = &PhaseError{Phase: "download", Err: err}
+		return
+	}
+	result.DownloadMbps = result.Download.estimate(warmup, c.config.Percentile) / 1000000.0
 }
 
-func (c *Client) measureDownload(ctx context.Context, url string, progress ProgressFunc) (float64, error) {
-	const targetDuration = 8 * time.Second
-	start := time.Now()
-	var totalRead int64
+func (c *Client) runUpload(ctx context.Context, target, probes *ProbesResponse, warmup time.Duration, progress ProgressFunc, result *SpeedResult) {
+	targetURL := c.SelectUploadURL(target)
+	if targetURL == "" {
+		result.UploadErr = &PhaseError{Phase: "upload", Err: ErrNoProbes}
+		return
+	}
+	result.UploadURL = targetURL
+	loaded := c.startLoadedLatency(ctx, probes, result)
+	stats, err := c.provider.MeasureUpload(ctx, targetURL, c.config.UploadSize, c.config.Concurrency, progress)
+	if stats != nil {
+		result.Upload = *stats
+	}
+	if loaded != nil {
+		result.UploadLatency = *loaded()
+	}
+	if err != nil {
+		result.UploadErr = &PhaseError{Phase: "upload", Err: err}
+		return
+	}
+	result.UploadMbps = result.Upload.estimate(warmup, c.config.Percentile) / 1000000.0
+}
 
-	for time.Since(start) < targetDuration {
-		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
-			if totalRead > 0 {
-				break
-			}
-			return 0, err
+func (y *yandexProvider) measureLatency(ctx context.Context, probes []Probe) (*LatencyStats, error) {
+	count := y.config.PingCount
+	var samples []time.Duration
+	var timings []Timing
+	var setup *Timing
+	sent := 0
+	var errs transferErrors
+
+	var hosts []*HostLatency
+	byHost := make(map[string]*HostLatency)
+	for _, p := range probes {
+		if p.URL == "" || byHost[probeHost(p.URL)] != nil {
+			continue
 		}
+		h := &HostLatency{Host: probeHost(p.URL)}
+		hosts = append(hosts, h)
+		byHost[h.Host] = h
+	}
 
-		pr := &progressReader{
-			Reader: resp.Body,
-			OnRead: func(n int) {
-				totalRead += int64(n)
-				if progress != nil {
-					progress(ProgressReport{Bytes: totalRead, IsDownload: true})
-				}
-			},
+	// The first request to each host pays for DNS, connect and TLS. It is
+	// kept as the setup breakdown, the samples are then taken on the warm
+	// keep-alive connection. Connections left over from the probe fetch
+	// are dropped first so that the setup request really dials.
+	y.httpClient.CloseIdleConnections()
+	warm := make(map[string]bool)
+	for _, p := range probes {
+		if p.URL == "" || warm[probeHost(p.URL)] {
+			continue
 		}
-
-		_, err = io.Copy(io.Discard, pr)
-		resp.Body.Close()
+		warm[probeHost(p.URL)] = true
+		t, err := y.Ping(ctx, p)
 		if err != nil {
-			break
+			errs.record(err)
+			byHost[probeHost(p.URL)].Err = err.Error()
+			continue
 		}
-
-		if time.Since(start) >= targetDuration {
-			break
+		if setup == nil && !t.Reused {
+			setup = &t
 		}
 	}
 
-	duration := time.Since(start).Seconds()
-	bitsPerSec := (float64(totalRead) * 8) / duration
-	return bitsPerSec, nil
-}
-
-func (c *Client) measureUpload(ctx context.Context, url string, size int, progress ProgressFunc) (float64, error) {
-	const targetDuration = 8 * time.Second
-	start := time.Now()
-	var totalWritten int64
-
-	for time.Since(start) < targetDuration {
-		pw := &progressReader{
-			Reader: &io.LimitedReader{R: &nullReader{}, N: int64(size)},
-			OnRead: func(n int) {
-				totalWritten += int64(n)
-				if progress != nil {
-					progress(ProgressReport{Bytes: totalWritten, IsDownload: false})
-				}
-			},
-		}
-
-		req, _ := http.NewRequestWithContext(ctx, "POST", url, pw)
-		req.ContentLength = int64(size)
-
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
-			if totalWritten > 0 {
-				break
+	for i := 0; i < count; i++ {
+		for _, p := range probes {
+			if p.URL == "" {
+				continue
 			}
-			return 0, err
-		}
-		resp.Body.Close()
-
-		if time.Since(start) >= targetDuration {
-			break
+			h := byHost[probeHost(p.URL)]
+			sent++
+			h.Sent++
+			t, err := y.Ping(ctx, p)
+			if err != nil {
+				errs.record(err)
+				h.Err = err.Error()
+				continue
+			}
+			samples = append(samples, t.TTFB)
+			h.Samples = append(h.Samples, t.TTFB)
+			timings = append(timings, t)
 		}
 	}
-
-	duration := time.Since(start).Seconds()
-	bitsPerSec := (float64(totalWritten) * 8) / duration
-	return bitsPerSec, nil
+	stats := newLatencyStats(samples, sent)
+	stats.Timings = timings
+	for _, h := range hosts {
+		hs := newLatencyStats(h.Samples, h.Sent)
+		h.Lost, h.Min, h.Median = hs.Lost, hs.Min, hs.Median
+		stats.Hosts = append(stats.Hosts, *h)
+	}
+	if setup != nil {
+		stats.Setup = *setup
+	}
+	if len(samples) == 0 {
+		return stats, errs.err(ctx, 0)
+	}
+	return stats, nil
 }
 
 type progressReader struct {
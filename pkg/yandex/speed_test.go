@@ -0,0 +1,172 @@
+package yandex_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Master290/internetometer-cli/pkg/yandex"
+	"github.com/Master290/internetometer-cli/pkg/yandex/yandextest"
+)
+
+// newTestClient starts a fake Internetometer and returns a client pointed
+// at it that runs phases quickly.
+func newTestClient(t *testing.T, opts yandextest.Options, phases yandex.Phase) (*yandex.Client, *yandextest.Server) {
+	t.Helper()
+	srv := yandextest.NewServer(opts)
+	t.Cleanup(srv.Close)
+
+	cfg := srv.Config()
+	cfg.Phases = phases
+	cfg.Duration = 500 * time.Millisecond
+	cfg.PingCount = 2
+	return yandex.NewClient(cfg), srv
+}
+
+func TestRunSpeedTest(t *testing.T) {
+	client, srv := newTestClient(t, yandextest.Options{Bandwidth: 10 << 20}, yandex.AllPhases)
+
+	res, err := client.RunSpeedTest(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("RunSpeedTest: %v", err)
+	}
+	if err := res.Err(); err != nil {
+		t.Fatalf("phase failed: %v", err)
+	}
+
+	if res.DownloadMbps <= 0 || res.Download.Bytes == 0 {
+		t.Errorf("download = %.2f Mbps over %d bytes, want some", res.DownloadMbps, res.Download.Bytes)
+	}
+	if res.UploadMbps <= 0 || res.Upload.Bytes == 0 {
+		t.Errorf("upload = %.2f Mbps over %d bytes, want some", res.UploadMbps, res.Upload.Bytes)
+	}
+	if srv.Uploaded() == 0 {
+		t.Error("the fake server received no upload")
+	}
+	// 3 latency probes, PingCount rounds each
+	if s := res.LatencyStats; s.Sent != 6 || s.Lost != 0 || len(s.Samples) != 6 {
+		t.Errorf("latency sent %d, lost %d, %d samples; want 6, 0, 6", s.Sent, s.Lost, len(s.Samples))
+	}
+	if res.Latency <= 0 || res.Latency != res.LatencyStats.Min {
+		t.Errorf("latency = %v, want the lowest sample %v", res.Latency, res.LatencyStats.Min)
+	}
+	// the probe list came over a connection to the same server
+	if setup := res.LatencyStats.Setup; setup.Reused || setup.TTFB <= 0 {
+		t.Errorf("setup = %+v, want a request on a fresh connection", setup)
+	}
+	if res.TestURL == "" || res.UploadURL == "" {
+		t.Errorf("test URLs = %q, %q, want both set", res.TestURL, res.UploadURL)
+	}
+}
+
+func TestRunSpeedTestStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		endpoint  string
+		code      int
+		throttled bool
+	}{
+		{"download 403", yandextest.Download, 403, true},
+		{"download 503", yandextest.Download, 503, false},
+		{"upload 403", yandextest.Upload, 403, true},
+		{"upload 500", yandextest.Upload, 500, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, _ := newTestClient(t, yandextest.Options{
+				Bandwidth: 10 << 20,
+				Status:    map[string]int{tc.endpoint: tc.code},
+			}, yandex.PhaseDownload|yandex.PhaseUpload)
+
+			res, err := client.RunSpeedTest(context.Background(), nil)
+			if err != nil {
+				t.Fatalf("RunSpeedTest: %v", err)
+			}
+
+			failed, failedMbps, other := res.DownloadErr, res.DownloadMbps, res.UploadErr
+			if tc.endpoint == yandextest.Upload {
+				failed, failedMbps, other = res.UploadErr, res.UploadMbps, res.DownloadErr
+			}
+			var se *yandex.StatusError
+			if !errors.As(failed, &se) || se.StatusCode != tc.code {
+				t.Fatalf("%s error = %v, want status %d", tc.endpoint, failed, tc.code)
+			}
+			if got := errors.Is(failed, yandex.ErrThrottled); got != tc.throttled {
+				t.Errorf("errors.Is(%v, ErrThrottled) = %v, want %v", failed, got, tc.throttled)
+			}
+			if failedMbps != 0 {
+				t.Errorf("%s = %.2f Mbps, want 0 for a failed phase", tc.endpoint, failedMbps)
+			}
+			if other != nil {
+				t.Errorf("the other phase failed too: %v", other)
+			}
+		})
+	}
+}
+
+func TestRunSpeedTestDropped(t *testing.T) {
+	client, _ := newTestClient(t, yandextest.Options{
+		Drop: map[string]bool{
+			yandextest.Latency:  true,
+			yandextest.Download: true,
+			yandextest.Upload:   true,
+		},
+	}, yandex.PhaseLatency|yandex.PhaseDownload|yandex.PhaseUpload)
+
+	res, err := client.RunSpeedTest(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("RunSpeedTest: %v", err)
+	}
+	for phase, err := range map[string]error{
+		"latency":  res.LatencyErr,
+		"download": res.DownloadErr,
+		"upload":   res.UploadErr,
+	} {
+		if !errors.Is(err, yandex.ErrConnRefused) {
+			t.Errorf("%s error = %v, want ErrConnRefused", phase, err)
+		}
+		var pe *yandex.PhaseError
+		if !errors.As(err, &pe) || pe.Phase != phase {
+			t.Errorf("%s error = %v, want a PhaseError for %s", phase, err, phase)
+		}
+	}
+}
+
+func TestRunSpeedTestDroppedMidBody(t *testing.T) {
+	client, _ := newTestClient(t, yandextest.Options{
+		Drop:      map[string]bool{yandextest.Download: true},
+		DropAfter: 256 << 10,
+	}, yandex.PhaseDownload)
+
+	res, err := client.RunSpeedTest(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("RunSpeedTest: %v", err)
+	}
+	// what arrived before the cut still counts
+	if res.DownloadErr != nil || res.DownloadMbps <= 0 {
+		t.Errorf("download = %.2f Mbps, %v; want a speed from the partial bodies", res.DownloadMbps, res.DownloadErr)
+	}
+}
+
+func TestRunSpeedTestProbeFetch(t *testing.T) {
+	client, _ := newTestClient(t, yandextest.Options{
+		Status: map[string]int{yandextest.Probes: 500},
+	}, yandex.AllPhases)
+
+	res, err := client.RunSpeedTest(context.Background(), nil)
+	if !errors.Is(err, yandex.ErrProbeFetch) {
+		t.Fatalf("RunSpeedTest error = %v, want ErrProbeFetch", err)
+	}
+	if res != nil {
+		t.Errorf("RunSpeedTest result = %+v, want nil", res)
+	}
+}
+
+func TestMeasureDownloadNoURLs(t *testing.T) {
+	client, _ := newTestClient(t, yandextest.Options{}, yandex.AllPhases)
+
+	_, err := client.Provider().MeasureDownload(context.Background(), nil, 1, nil)
+	if !errors.Is(err, yandex.ErrNoProbes) {
+		t.Fatalf("MeasureDownload error = %v, want ErrNoProbes", err)
+	}
+}
@@ -0,0 +1,388 @@
+package yandex
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const sampleInterval = 100 * time.Millisecond
+
+// rateWindow is the span of the moving averages behind the adaptive stop.
+const rateWindow = time.Second
+
+// TransferStats describes a download or upload phase. BitsPerSec averages
+// the whole phase, SteadyBitsPerSec leaves out the first Warmup of it.
+type TransferStats struct {
+	Bytes       int64              `json:"bytes"`
+	Duration    time.Duration      `json:"duration_ns"`
+	BitsPerSec  float64            `json:"bits_per_sec"`
+	Connections []ConnectionStats  `json:"connections"`
+	Samples     []ThroughputSample `json:"samples"`
+
+	// Hosts adds up the connections per probe host, for phases spread
+	// over several of them.
+	Hosts []HostThroughput `json:"hosts"`
+
+	// Concurrency is the number of parallel streams that carried the
+	// phase once all of them were running, the one picked by the ramp-up
+	// in auto mode. RampUp is how long that ramp-up took, it is left out
+	// of the reported speed like Warmup.
+	Concurrency int           `json:"concurrency"`
+	RampUp      time.Duration `json:"ramp_up_ns,omitempty"`
+
+	// Stable is set when an adaptive phase ended early because
+	// throughput had settled.
+	Stable bool `json:"stable"`
+
+	Warmup           time.Duration `json:"warmup_ns"`
+	SteadyBitsPerSec float64       `json:"steady_bits_per_sec"`
+
+	// PercentileBitsPerSec is the Percentile-th percentile of the samples
+	// taken after warm-up, set only when a percentile was requested.
+	Percentile           float64 `json:"percentile,omitempty"`
+	PercentileBitsPerSec float64 `json:"percentile_bits_per_sec,omitempty"`
+}
+
+// estimate fills the steady-state and percentile figures from the samples
+// and returns the one to report. The warm-up lasts at least as long as the
+// ramp-up; one that covers the whole phase is ignored.
+func (s *TransferStats) estimate(warmup time.Duration, percentile float64) float64 {
+	s.Warmup = 0
+	s.SteadyBitsPerSec = s.BitsPerSec
+	warmup = max(warmup, s.RampUp)
+
+	from := 0
+	if warmup > 0 {
+		for i, sample := range s.Samples {
+			if sample.Elapsed < warmup {
+				continue
+			}
+			steady := s.Duration - sample.Elapsed
+			if i == len(s.Samples)-1 || steady <= 0 {
+				break
+			}
+			s.Warmup = sample.Elapsed
+			s.SteadyBitsPerSec = float64(s.Bytes-sample.Bytes) * 8 / steady.Seconds()
+			from = i + 1
+			break
+		}
+	}
+
+	if percentile <= 0 {
+		return s.SteadyBitsPerSec
+	}
+	var rates []float64
+	for _, sample := range s.Samples[from:] {
+		rates = append(rates, sample.BitsPerSec)
+	}
+	if len(rates) == 0 {
+		return s.SteadyBitsPerSec
+	}
+	sort.Float64s(rates)
+	s.Percentile = percentile
+	s.PercentileBitsPerSec = percentileOf(rates, percentile)
+	return s.PercentileBitsPerSec
+}
+
+// percentileOf picks the nearest-rank p-th percentile of sorted values.
+func percentileOf(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// ConnectionStats is the share of a phase carried by one parallel worker.
+type ConnectionStats struct {
+	Host       string  `json:"host"`
+	Bytes      int64   `json:"bytes"`
+	Requests   int     `json:"requests"`
+	BitsPerSec float64 `json:"bits_per_sec"`
+}
+
+// HostThroughput is the share of a phase carried by one probe host.
+type HostThroughput struct {
+	Host        string  `json:"host"`
+	Connections int     `json:"connections"`
+	Bytes       int64   `json:"bytes"`
+	BitsPerSec  float64 `json:"bits_per_sec"`
+}
+
+// ThroughputSample is the aggregate rate over one sampling interval.
+type ThroughputSample struct {
+	Elapsed    time.Duration `json:"elapsed_ns"`
+	Bytes      int64         `json:"bytes"`
+	BitsPerSec float64       `json:"bits_per_sec"`
+}
+
+// LatencyStats summarises the latency probes. Jitter is the mean absolute
+// difference between consecutive samples, RFC3550Jitter the smoothed
+// interarrival jitter of RFC 3550 section 6.4.1 that VoIP tools report.
+type LatencyStats struct {
+	Min           time.Duration `json:"min_ns"`
+	Avg           time.Duration `json:"avg_ns"`
+	Median        time.Duration `json:"median_ns"`
+	P95           time.Duration `json:"p95_ns"`
+	Max           time.Duration `json:"max_ns"`
+	StdDev        time.Duration `json:"stddev_ns"`
+	Jitter        time.Duration `json:"jitter_ns"`
+	RFC3550Jitter time.Duration `json:"jitter_rfc3550_ns"`
+
+	Sent    int             `json:"sent"`
+	Lost    int             `json:"lost"`
+	Samples []time.Duration `json:"samples_ns"`
+
+	// Setup is the breakdown of the first, cold request; Timings belong
+	// to the samples, taken on warm connections.
+	Setup   Timing   `json:"setup"`
+	Timings []Timing `json:"timings,omitempty"`
+
+	// Hosts breaks the samples down by latency probe host, in the order
+	// get-probes listed them.
+	Hosts []HostLatency `json:"hosts,omitempty"`
+}
+
+// HostLatency is the part of the latency probes sent to one host.
+type HostLatency struct {
+	Host    string          `json:"host"`
+	Sent    int             `json:"sent"`
+	Lost    int             `json:"lost"`
+	Min     time.Duration   `json:"min_ns"`
+	Median  time.Duration   `json:"median_ns"`
+	Samples []time.Duration `json:"samples_ns"`
+
+	// Err is the last failure seen for the host, the warm-up request
+	// included.
+	Err string `json:"error,omitempty"`
+}
+
+func newLatencyStats(samples []time.Duration, sent int) *LatencyStats {
+	stats := &LatencyStats{
+		Sent:    sent,
+		Lost:    sent - len(samples),
+		Samples: samples,
+	}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum time.Duration
+	for _, s := range sorted {
+		sum += s
+	}
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	stats.Avg = sum / time.Duration(len(sorted))
+	if n := len(sorted); n%2 == 1 {
+		stats.Median = sorted[n/2]
+	} else {
+		stats.Median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+
+	values := make([]float64, len(sorted))
+	var sq float64
+	for i, s := range sorted {
+		values[i] = float64(s)
+		d := float64(s - stats.Avg)
+		sq += d * d
+	}
+	stats.P95 = time.Duration(percentileOf(values, 95))
+	stats.StdDev = time.Duration(math.Sqrt(sq / float64(len(values))))
+
+	if len(samples) > 1 {
+		var diff time.Duration
+		var j float64
+		for i := 1; i < len(samples); i++ {
+			d := samples[i] - samples[i-1]
+			if d < 0 {
+				d = -d
+			}
+			diff += d
+			j += (float64(d) - j) / 16
+		}
+		stats.Jitter = diff / time.Duration(len(samples)-1)
+		stats.RFC3550Jitter = time.Duration(j)
+	}
+	return stats
+}
+
+// transferMeter accounts the bytes moved by parallel workers and samples
+// the aggregate rate every sampleInterval.
+type transferMeter struct {
+	start time.Time
+	urls  []string
+	total int64
+	errs  transferErrors
+
+	mu      sync.Mutex
+	conns   []*connMeter
+	samples []ThroughputSample
+}
+
+type connMeter struct {
+	url      string
+	bytes    int64
+	requests int64
+	// steady is what the connection had moved when the ramp-up ended.
+	steady int64
+}
+
+func newTransferMeter(start time.Time, urls []string) *transferMeter {
+	return &transferMeter{start: start, urls: urls}
+}
+
+// conn registers a new worker, assigned the next of the meter's urls.
+func (m *transferMeter) conn() *connMeter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := &connMeter{url: m.urls[len(m.conns)%len(m.urls)]}
+	m.conns = append(m.conns, c)
+	return c
+}
+
+// add books n bytes (negative to take back a rejected upload) and returns
+// the new phase total.
+func (m *transferMeter) add(c *connMeter, n int64) int64 {
+	atomic.AddInt64(&c.bytes, n)
+	return atomic.AddInt64(&m.total, n)
+}
+
+// rampDone marks the end of the ramp-up, so that stats can tell which
+// connections still carried traffic after it.
+func (m *transferMeter) rampDone() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.conns {
+		c.steady = atomic.LoadInt64(&c.bytes)
+	}
+}
+
+func (m *transferMeter) request(c *connMeter) {
+	atomic.AddInt64(&c.requests, 1)
+}
+
+func (m *transferMeter) bytes() int64 {
+	return atomic.LoadInt64(&m.total)
+}
+
+// sample records throughput until done is closed.
+func (m *transferMeter) sample(done <-chan struct{}) {
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+
+	last := m.start
+	var lastBytes int64
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			total := m.bytes()
+			s := ThroughputSample{
+				Elapsed: now.Sub(m.start),
+				Bytes:   total,
+			}
+			if secs := now.Sub(last).Seconds(); secs > 0 {
+				s.BitsPerSec = float64(total-lastBytes) * 8 / secs
+			}
+			last, lastBytes = now, total
+
+			m.mu.Lock()
+			m.samples = append(m.samples, s)
+			m.mu.Unlock()
+		}
+	}
+}
+
+// stable reports whether throughput has settled: whether the 1s moving
+// averages of the samples taken after from varied by less than threshold
+// (as a coefficient of variation) over the last window. Moving averages
+// follow the current rate, where the average since the start of the phase
+// would lag behind it ever more as the phase goes on.
+func (m *transferMeter) stable(from, window time.Duration, threshold float64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := int(window / sampleInterval)
+	span := int(rateWindow / sampleInterval)
+	first := sort.Search(len(m.samples), func(i int) bool {
+		return m.samples[i].Elapsed-sampleInterval >= from
+	})
+	samples := m.samples[first:]
+	if n < 2 || len(samples) < n+span-1 {
+		return false
+	}
+	samples = samples[len(samples)-(n+span-1):]
+
+	var sum, sumSq float64
+	for i := 0; i < n; i++ {
+		var avg float64
+		for _, s := range samples[i : i+span] {
+			avg += s.BitsPerSec
+		}
+		avg /= float64(span)
+		sum += avg
+		sumSq += avg * avg
+	}
+	mean := sum / float64(n)
+	if mean <= 0 {
+		return false
+	}
+	variance := max(sumSq/float64(n)-mean*mean, 0)
+	return math.Sqrt(variance)/mean < threshold
+}
+
+func (m *transferMeter) stats() *TransferStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	duration := time.Since(m.start)
+	secs := duration.Seconds()
+	stats := &TransferStats{
+		Bytes:    m.bytes(),
+		Duration: duration,
+		Samples:  m.samples,
+	}
+	if secs > 0 {
+		stats.BitsPerSec = float64(stats.Bytes) * 8 / secs
+	}
+	hosts := make(map[string]int)
+	for _, c := range m.conns {
+		cs := ConnectionStats{
+			Host:     probeHost(c.url),
+			Bytes:    atomic.LoadInt64(&c.bytes),
+			Requests: int(atomic.LoadInt64(&c.requests)),
+		}
+		if secs > 0 {
+			cs.BitsPerSec = float64(cs.Bytes) * 8 / secs
+		}
+		stats.Connections = append(stats.Connections, cs)
+		if cs.Bytes > c.steady {
+			stats.Concurrency++
+		}
+
+		i, ok := hosts[cs.Host]
+		if !ok {
+			i = len(stats.Hosts)
+			hosts[cs.Host] = i
+			stats.Hosts = append(stats.Hosts, HostThroughput{Host: cs.Host})
+		}
+		h := &stats.Hosts[i]
+		h.Connections++
+		h.Bytes += cs.Bytes
+		h.BitsPerSec += cs.BitsPerSec
+	}
+	return stats
+}
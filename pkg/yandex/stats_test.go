@@ -0,0 +1,260 @@
+package yandex
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// transferStats lays out a phase sampled every 100ms that moved bytes[i]
+// in the i-th interval.
+func transferStats(bytes ...int64) *TransferStats {
+	s := &TransferStats{Duration: time.Duration(len(bytes)) * sampleInterval}
+	for i, b := range bytes {
+		s.Bytes += b
+		s.Samples = append(s.Samples, ThroughputSample{
+			Elapsed:    time.Duration(i+1) * sampleInterval,
+			Bytes:      s.Bytes,
+			BitsPerSec: float64(b) * 8 / sampleInterval.Seconds(),
+		})
+	}
+	if s.Duration > 0 {
+		s.BitsPerSec = float64(s.Bytes) * 8 / s.Duration.Seconds()
+	}
+	return s
+}
+
+func TestEstimate(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		bytes      []int64
+		warmup     time.Duration
+		percentile float64
+
+		want       float64
+		wantWarmup time.Duration
+	}{
+		{
+			name:  "whole phase",
+			bytes: []int64{0, 0, 100, 100, 100, 100, 100, 100, 100, 100},
+			want:  6400,
+		},
+		{
+			name:       "warm-up left out",
+			bytes:      []int64{0, 0, 100, 100, 100, 100, 100, 100, 100, 100},
+			warmup:     200 * time.Millisecond,
+			want:       8000,
+			wantWarmup: 200 * time.Millisecond,
+		},
+		{
+			name:       "warm-up cut at the next sample",
+			bytes:      []int64{0, 0, 100, 100, 100, 100, 100, 100, 100, 100},
+			warmup:     150 * time.Millisecond,
+			want:       8000,
+			wantWarmup: 200 * time.Millisecond,
+		},
+		{
+			name:   "warm-up up to the last sample is ignored",
+			bytes:  []int64{0, 0, 100, 100, 100, 100, 100, 100, 100, 100},
+			warmup: time.Second,
+			want:   6400,
+		},
+		{
+			name:   "warm-up longer than the phase is ignored",
+			bytes:  []int64{0, 0, 100, 100, 100, 100, 100, 100, 100, 100},
+			warmup: 2 * time.Second,
+			want:   6400,
+		},
+		{
+			name:       "percentile after warm-up",
+			bytes:      []int64{0, 0, 10, 20, 30, 40, 50, 60, 70, 80},
+			warmup:     200 * time.Millisecond,
+			percentile: 90,
+			want:       6400,
+			wantWarmup: 200 * time.Millisecond,
+		},
+		{
+			name:       "median after warm-up",
+			bytes:      []int64{0, 0, 10, 20, 30, 40, 50, 60, 70, 80},
+			warmup:     200 * time.Millisecond,
+			percentile: 50,
+			want:       3200,
+			wantWarmup: 200 * time.Millisecond,
+		},
+		{
+			name:       "median with the warm-up in",
+			bytes:      []int64{0, 0, 10, 20, 30, 40, 50, 60, 70, 80},
+			percentile: 50,
+			want:       2400,
+		},
+		{
+			name:       "percentile without samples",
+			percentile: 90,
+			want:       0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := transferStats(tc.bytes...)
+			got := s.estimate(tc.warmup, tc.percentile)
+			if math.Abs(got-tc.want) > 1e-6 {
+				t.Errorf("estimate = %v, want %v", got, tc.want)
+			}
+			if s.Warmup != tc.wantWarmup {
+				t.Errorf("Warmup = %v, want %v", s.Warmup, tc.wantWarmup)
+			}
+		})
+	}
+}
+
+func TestPercentileOf(t *testing.T) {
+	ten := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for _, tc := range []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{nil, 90, 0},
+		{[]float64{7}, 95, 7},
+		{ten, 0, 1},
+		{ten, 1, 1},
+		{ten, 50, 5},
+		{ten, 90, 9},
+		{ten, 91, 10},
+		{ten, 100, 10},
+	} {
+		if got := percentileOf(tc.sorted, tc.p); got != tc.want {
+			t.Errorf("percentileOf(%v, %v) = %v, want %v", tc.sorted, tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestNewLatencyStats(t *testing.T) {
+	ms := func(v ...float64) []time.Duration {
+		var d []time.Duration
+		for _, x := range v {
+			d = append(d, time.Duration(x*float64(time.Millisecond)))
+		}
+		return d
+	}
+	for _, tc := range []struct {
+		name    string
+		samples []time.Duration
+		sent    int
+		want    LatencyStats
+	}{
+		{
+			name:    "even count",
+			samples: ms(20, 10, 40, 30),
+			sent:    4,
+			want: LatencyStats{
+				Min: 10 * time.Millisecond, Avg: 25 * time.Millisecond, Median: 25 * time.Millisecond,
+				P95: 40 * time.Millisecond, Max: 40 * time.Millisecond,
+				// sqrt((15² + 5² + 5² + 15²) / 4) ms
+				StdDev: 11180339,
+				// differences 10, 30 and 10 ms, in arrival order
+				Jitter: 50 * time.Millisecond / 3,
+				// J += (|D| - J) / 16 for each of them
+				RFC3550Jitter: 2932128,
+				Sent:          4,
+			},
+		},
+		{
+			name:    "odd count",
+			samples: ms(5, 1, 3),
+			sent:    3,
+			want: LatencyStats{
+				Min: time.Millisecond, Avg: 3 * time.Millisecond, Median: 3 * time.Millisecond,
+				P95: 5 * time.Millisecond, Max: 5 * time.Millisecond,
+				StdDev:        1632993,
+				Jitter:        3 * time.Millisecond,
+				RFC3550Jitter: 359375,
+				Sent:          3,
+			},
+		},
+		{
+			name:    "single sample",
+			samples: ms(7),
+			sent:    3,
+			want: LatencyStats{
+				Min: 7 * time.Millisecond, Avg: 7 * time.Millisecond, Median: 7 * time.Millisecond,
+				P95: 7 * time.Millisecond, Max: 7 * time.Millisecond,
+				Sent: 3, Lost: 2,
+			},
+		},
+		{
+			name: "everything lost",
+			sent: 3,
+			want: LatencyStats{Sent: 3, Lost: 3},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := newLatencyStats(tc.samples, tc.sent)
+			for _, f := range []struct {
+				name      string
+				got, want time.Duration
+			}{
+				{"Min", got.Min, tc.want.Min},
+				{"Avg", got.Avg, tc.want.Avg},
+				{"Median", got.Median, tc.want.Median},
+				{"P95", got.P95, tc.want.P95},
+				{"Max", got.Max, tc.want.Max},
+				{"StdDev", got.StdDev, tc.want.StdDev},
+				{"Jitter", got.Jitter, tc.want.Jitter},
+				{"RFC3550Jitter", got.RFC3550Jitter, tc.want.RFC3550Jitter},
+			} {
+				// a nanosecond of float rounding is fine
+				if d := f.got - f.want; d < -1 || d > 1 {
+					t.Errorf("%s = %v, want %v", f.name, f.got, f.want)
+				}
+			}
+			if got.Sent != tc.want.Sent || got.Lost != tc.want.Lost {
+				t.Errorf("sent %d, lost %d; want %d, %d", got.Sent, got.Lost, tc.want.Sent, tc.want.Lost)
+			}
+		})
+	}
+}
+
+func TestTransferMeterStable(t *testing.T) {
+	repeat := func(n int, b int64) []int64 {
+		var bytes []int64
+		for range n {
+			bytes = append(bytes, b)
+		}
+		return bytes
+	}
+	climb := func(n int, from, step int64) []int64 {
+		var bytes []int64
+		for i := range n {
+			bytes = append(bytes, from+int64(i+1)*step)
+		}
+		return bytes
+	}
+	ramp := func(n int) []int64 { return climb(n, 0, 100) }
+	for _, tc := range []struct {
+		name   string
+		bytes  []int64
+		from   time.Duration
+		window time.Duration
+		want   bool
+	}{
+		// a second of 1s moving averages takes 19 samples
+		{"steady", repeat(19, 1000), 0, time.Second, true},
+		{"small wobble", append(repeat(19, 1000), 1010, 990, 1010, 990), 0, time.Second, true},
+		{"too few samples", repeat(18, 1000), 0, time.Second, false},
+		{"warm-up leaves too few samples", repeat(19, 1000), 500 * time.Millisecond, time.Second, false},
+		{"slow start past the warm-up", append(repeat(10, 100), repeat(19, 1000)...), time.Second, time.Second, true},
+		{"still ramping up", ramp(30), 0, time.Second, false},
+		// the average since the start moves by under 1% over the last
+		// second, the current rate by over 5%
+		{"average lags a climbing rate", append(repeat(100, 1000), climb(20, 1000, 25)...), 0, time.Second, false},
+		{"nothing moved", repeat(19, 0), 0, time.Second, false},
+		{"window under two samples", repeat(19, 1000), 0, sampleInterval, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &transferMeter{samples: transferStats(tc.bytes...).Samples}
+			if got := m.stable(tc.from, tc.window, 0.02); got != tc.want {
+				t.Errorf("stable = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
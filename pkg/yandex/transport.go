@@ -0,0 +1,157 @@
+package yandex
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// IPFamily restricts the connections of a client to one address family.
+type IPFamily uint8
+
+const (
+	IPAny IPFamily = iota
+	IPv4Only
+	IPv6Only
+)
+
+func (f IPFamily) String() string {
+	switch f {
+	case IPv4Only:
+		return "ipv4"
+	case IPv6Only:
+		return "ipv6"
+	}
+	return "any"
+}
+
+// network narrows base, "tcp" or "udp", to the family.
+func (f IPFamily) network(base string) string {
+	switch f {
+	case IPv4Only:
+		return base + "4"
+	case IPv6Only:
+		return base + "6"
+	}
+	return base
+}
+
+// newTransport returns the transport every request of a client goes
+// through, dialing only the configured address family from the configured
+// source address, via the configured proxy as recorded in proxies. Host
+// names are looked up with resolver, nil for the system one; resolverErr
+// fails every dial when Config.DNSServer could not be used.
+//
+// Unlike http.DefaultTransport, which keeps two idle connections per
+// host, its pool holds one connection per parallel stream plus a couple
+// for the latency probes, so streams do not redial between requests.
+// HTTP/2 is off unless asked for: it would multiplex every stream over a
+// single TCP connection and defeat Concurrency.
+func newTransport(cfg *Config, proxies *proxyLog, resolver *net.Resolver, resolverErr error) *http.Transport {
+	streams := cfg.Concurrency
+	if streams == ConcurrencyAuto {
+		streams = cfg.MaxConcurrency
+	}
+	pool := max(streams, cfg.DownloadServers) + 2
+	t := &http.Transport{
+		Proxy:                 proxies.wrap(cfg.proxyFunc()),
+		MaxIdleConns:          4 * pool,
+		MaxIdleConnsPerHost:   pool,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		ReadBufferSize:        cfg.ReadBufferSize,
+		WriteBufferSize:       cfg.WriteBufferSize,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+		ForceAttemptHTTP2:     cfg.HTTP2,
+	}
+	if !cfg.HTTP2 {
+		// a non-nil empty map is how net/http is told not to negotiate h2
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	dial := cfg.dialer(resolver)
+	t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		if resolverErr != nil {
+			return nil, resolverErr
+		}
+		return dial(ctx, "tcp", addr)
+	}
+	return t
+}
+
+// dialer returns a dial func for the configured address family and source
+// address that looks host names up with resolver, nil for the system one.
+// The network is "tcp" or "udp"; the family narrows it further.
+func (cfg *Config) dialer(resolver *net.Resolver) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: cfg.KeepAlive,
+			Resolver:  resolver,
+		}
+		local, err := cfg.localAddr()
+		if err != nil {
+			return nil, err
+		}
+		if local != nil {
+			if network == "udp" {
+				dialer.LocalAddr = &net.UDPAddr{IP: local.IP}
+			} else {
+				dialer.LocalAddr = local
+			}
+		}
+		return dialer.DialContext(ctx, cfg.IPFamily.network(network), addr)
+	}
+}
+
+// localAddr is the address to dial from, nil to let the system pick. The
+// interface is looked up on every dial so that an address change does
+// not need a new client.
+func (cfg *Config) localAddr() (*net.TCPAddr, error) {
+	if cfg.SourceIP != "" {
+		ip := net.ParseIP(cfg.SourceIP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source IP %q", cfg.SourceIP)
+		}
+		return &net.TCPAddr{IP: ip}, nil
+	}
+	if cfg.Interface == "" {
+		return nil, nil
+	}
+
+	iface, err := net.InterfaceByName(cfg.Interface)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", cfg.Interface, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", cfg.Interface, err)
+	}
+	// IPv4 is preferred unless the client is IPv6-only; link-local IPv6
+	// addresses cannot reach the probes.
+	var v6 net.IP
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ip4 := ipnet.IP.To4(); ip4 != nil {
+			if cfg.IPFamily != IPv6Only {
+				return &net.TCPAddr{IP: ip4}, nil
+			}
+		} else if v6 == nil {
+			v6 = ipnet.IP
+		}
+	}
+	if v6 != nil && cfg.IPFamily != IPv4Only {
+		return &net.TCPAddr{IP: v6}, nil
+	}
+	if cfg.IPFamily == IPAny {
+		return nil, fmt.Errorf("interface %s has no usable address", cfg.Interface)
+	}
+	return nil, fmt.Errorf("interface %s has no usable %s address", cfg.Interface, cfg.IPFamily)
+}
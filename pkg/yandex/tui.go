@@ -2,6 +2,7 @@ package yandex
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
@@ -39,6 +40,12 @@ type model struct {
 	uploadMbps   float64
 	curMbps      float64
 	latency      string
+	jitter       string
+	spread       string
+	setup        string
+	loaded       string
+	downloadErr  error
+	uploadErr    error
 
 	phase          string
 	phaseStartTime time.Time
@@ -46,8 +53,6 @@ type model struct {
 	err            error
 }
 
-const phaseTotalTime = 8.0
-
 type progressMsg ProgressReport
 type resultMsg struct {
 	res *SpeedResult
@@ -61,12 +66,12 @@ func (m model) Init() tea.Cmd {
 		m.spinner.Tick,
 		func() tea.Cmd {
 			return func() tea.Msg {
-				ipv4, _ := m.client.GetIPv4()
-				ipv6, _ := m.client.GetIPv6()
-				region, _ := m.client.GetRegion()
-				isp, _ := m.client.GetISP()
+				ipv4, _ := m.client.GetIPv4Context(m.ctx)
+				ipv6, _ := m.client.GetIPv6Context(m.ctx)
+				region, _ := m.client.GetRegionContext(m.ctx)
+				isp, _ := m.client.GetISPContext(m.ctx)
 				var testURL string
-				probes, err := m.client.GetProbes()
+				probes, err := m.client.GetProbesContext(m.ctx)
 				if err == nil {
 					target := m.client.SelectDownloadProbe(probes)
 					if target != nil {
@@ -108,7 +113,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.isp = msg.isp.Name
 			}
 		}
-		m.phase = "download"
+		m.phase = firstPhase(m.client.config.Phases)
 		m.phaseStartTime = time.Now()
 		m.phasePercent = 0
 		return m, m.runSpeedTestCmd(program)
@@ -120,7 +125,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.curMbps = float64(msg)
 		if !m.phaseStartTime.IsZero() {
 			elapsed := time.Since(m.phaseStartTime).Seconds()
-			m.phasePercent = elapsed / phaseTotalTime
+			m.phasePercent = elapsed / m.client.config.phaseDuration().Seconds()
 			if m.phasePercent > 1.0 {
 				m.phasePercent = 1.0
 			}
@@ -138,7 +143,23 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		} else {
 			m.downloadMbps = msg.res.DownloadMbps
 			m.uploadMbps = msg.res.UploadMbps
+			lang := m.client.config.Language
 			m.latency = fmt.Sprintf("%d ms", msg.res.Latency.Milliseconds())
+			m.jitter = fmt.Sprintf("%.1f ms (RFC 3550: %.1f ms)",
+				durationMs(msg.res.LatencyStats.Jitter), durationMs(msg.res.LatencyStats.RFC3550Jitter))
+			m.spread = fmt.Sprintf("%s %.1f ms, p95 %.1f ms, %s %.1f ms",
+				Translate(lang, "median"), durationMs(msg.res.LatencyStats.Median), durationMs(msg.res.LatencyStats.P95),
+				Translate(lang, "stddev"), durationMs(msg.res.LatencyStats.StdDev))
+			m.setup = msg.res.LatencyStats.Setup.String()
+			if msg.res.LatencyErr != nil {
+				m.latency = Translate(lang, "failed") + ": " + TranslateError(lang, errors.Unwrap(msg.res.LatencyErr).Error())
+				m.jitter = ""
+				m.spread = ""
+				m.setup = ""
+			}
+			m.loaded = formatLoadedLatency(msg.res, lang)
+			m.downloadErr = msg.res.DownloadErr
+			m.uploadErr = msg.res.UploadErr
 			m.testURL = msg.res.TestURL
 		}
 		m.phase = "done"
@@ -150,6 +171,34 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 type currentMbpsMsg float64
 type phaseMsg string
 
+func formatLoadedLatency(res *SpeedResult, lang string) string {
+	var parts []string
+	if len(res.DownloadLatency.Samples) > 0 {
+		parts = append(parts, fmt.Sprintf("%d ms %s", res.DownloadLatency.Median.Milliseconds(), Translate(lang, "down")))
+	}
+	if len(res.UploadLatency.Samples) > 0 {
+		parts = append(parts, fmt.Sprintf("%d ms %s", res.UploadLatency.Median.Milliseconds(), Translate(lang, "up")))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	s := strings.Join(parts, " / ")
+	if res.Bufferbloat.Grade != "" {
+		s += Translatef(lang, " (bufferbloat: %s)", res.Bufferbloat.Grade)
+	}
+	return s
+}
+
+func firstPhase(phases Phase) string {
+	switch {
+	case phases.Has(PhaseDownload):
+		return "download"
+	case phases.Has(PhaseUpload):
+		return "upload"
+	}
+	return "latency"
+}
+
 func (m model) runSpeedTestCmd(p *tea.Program) tea.Cmd {
 	return func() tea.Msg {
 		if p == nil {
@@ -157,7 +206,7 @@ func (m model) runSpeedTestCmd(p *tea.Program) tea.Cmd {
 		}
 
 		var mu sync.Mutex
-		currentIsDownload := true
+		currentIsDownload := m.client.config.Phases.Has(PhaseDownload)
 		var lastUpdate time.Time
 		var phaseStartTime time.Time
 
@@ -195,47 +244,81 @@ func (m model) runSpeedTestCmd(p *tea.Program) tea.Cmd {
 }
 
 func (m model) View() string {
+	lang := m.client.config.Language
 	if m.err != nil {
-		return fmt.Sprintf("Error: %v\n", m.err)
+		return fmt.Sprintf("%s: %s\n", Translate(lang, "Error"), TranslateError(lang, m.err.Error()))
 	}
 
 	var s strings.Builder
-	s.WriteString(titleStyle.Render("Yandex Internetometer CLI"))
+	s.WriteString(titleStyle.Render(Translate(lang, "Yandex Internetometer CLI")))
 	s.WriteString("\n\n")
 
-	s.WriteString(fmt.Sprintf("IPv4:   %s\n", m.ipv4))
+	info := Labels(lang, "IPv4", "IPv6", "Region", "ISP")
+	s.WriteString(fmt.Sprintf("%s%s\n", info["IPv4"], m.ipv4))
 	if m.ipv6 != "" {
-		s.WriteString(fmt.Sprintf("IPv6:   %s\n", m.ipv6))
+		s.WriteString(fmt.Sprintf("%s%s\n", info["IPv6"], m.ipv6))
 	}
 	if m.testURL != "" {
 		displayURL := m.testURL
 		if u, err := url.Parse(m.testURL); err == nil {
 			displayURL = u.Host
 		}
-		s.WriteString(fmt.Sprintf("Region: %s (%s)\n", m.region, displayURL))
+		s.WriteString(fmt.Sprintf("%s%s (%s)\n", info["Region"], m.region, displayURL))
 	} else {
-		s.WriteString(fmt.Sprintf("Region: %s\n", m.region))
+		s.WriteString(fmt.Sprintf("%s%s\n", info["Region"], m.region))
 	}
-	s.WriteString(fmt.Sprintf("ISP:    %s\n", m.isp))
+	s.WriteString(fmt.Sprintf("%s%s\n", info["ISP"], m.isp))
 	s.WriteString("\n")
 
+	measuring := Labels(lang, "Measuring Download", "Measuring Upload")
+	results := Labels(lang, "Download", "Upload", "Latency", "Jitter", "Spread", "Setup", "Loaded")
+	failed := Translate(lang, "failed")
 	switch m.phase {
 	case "init":
-		s.WriteString(m.spinner.View() + " Gathering information...")
+		s.WriteString(m.spinner.View() + " " + Translate(lang, "Gathering information..."))
+	case "latency":
+		s.WriteString(m.spinner.View() + " " + Translate(lang, "Measuring Latency..."))
 	case "download":
-		s.WriteString(m.spinner.View() + fmt.Sprintf(" Measuring Download: %.2f Mbps\n", m.curMbps))
+		s.WriteString(m.spinner.View() + fmt.Sprintf(" %s%s\n", measuring["Measuring Download"], m.client.config.Unit.Format(m.curMbps)))
 		s.WriteString(m.renderBar())
 	case "upload":
-		s.WriteString(m.spinner.View() + fmt.Sprintf(" Measuring Upload:   %.2f Mbps\n", m.curMbps))
+		s.WriteString(m.spinner.View() + fmt.Sprintf(" %s%s\n", measuring["Measuring Upload"], m.client.config.Unit.Format(m.curMbps)))
 		s.WriteString(m.renderBar())
 	case "done":
-		s.WriteString(keywordStyle.Render("Results:"))
-		s.WriteString(fmt.Sprintf("\nDownload: %.2f Mbps", m.downloadMbps))
-		s.WriteString(fmt.Sprintf("\nUpload:   %.2f Mbps", m.uploadMbps))
-		s.WriteString(fmt.Sprintf("\nLatency:  %s", m.latency))
+		s.WriteString(keywordStyle.Render(Translate(lang, "Results:")))
+		phases := m.client.config.Phases
+		switch {
+		case !phases.Has(PhaseDownload):
+		case m.downloadErr != nil:
+			s.WriteString(fmt.Sprintf("\n%s%s: %s", results["Download"], failed, TranslateError(lang, errors.Unwrap(m.downloadErr).Error())))
+		default:
+			s.WriteString(fmt.Sprintf("\n%s%s", results["Download"], m.client.config.Unit.Format(m.downloadMbps)))
+		}
+		switch {
+		case !phases.Has(PhaseUpload):
+		case m.uploadErr != nil:
+			s.WriteString(fmt.Sprintf("\n%s%s: %s", results["Upload"], failed, TranslateError(lang, errors.Unwrap(m.uploadErr).Error())))
+		default:
+			s.WriteString(fmt.Sprintf("\n%s%s", results["Upload"], m.client.config.Unit.Format(m.uploadMbps)))
+		}
+		if phases.Has(PhaseLatency) {
+			s.WriteString(fmt.Sprintf("\n%s%s", results["Latency"], m.latency))
+			if m.jitter != "" {
+				s.WriteString(fmt.Sprintf("\n%s%s", results["Jitter"], m.jitter))
+			}
+			if m.spread != "" {
+				s.WriteString(fmt.Sprintf("\n%s%s", results["Spread"], m.spread))
+			}
+			if m.setup != "" {
+				s.WriteString(fmt.Sprintf("\n%s%s", results["Setup"], m.setup))
+			}
+		}
+		if m.loaded != "" {
+			s.WriteString(fmt.Sprintf("\n%s%s", results["Loaded"], m.loaded))
+		}
 	}
 
-	s.WriteString("\n\n" + infoStyle.Render("Press q or Ctrl+C to quit"))
+	s.WriteString("\n\n" + infoStyle.Render(Translate(lang, "Press q or Ctrl+C to quit")))
 	return s.String()
 }
 
@@ -244,7 +327,13 @@ func (m model) renderBar() string {
 }
 
 func RunTUI(client *Client) error {
-	ctx, cancel := context.WithCancel(context.Background())
+	return RunTUIContext(context.Background(), client)
+}
+
+// RunTUIContext is like RunTUI but stops every network operation once ctx
+// is done.
+func RunTUIContext(ctx context.Context, client *Client) error {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	s := spinner.New()
@@ -0,0 +1,70 @@
+package yandex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SpeedUnit is how speeds are printed for people. Measurements themselves
+// are always kept in bits per second.
+type SpeedUnit uint8
+
+const (
+	// UnitMbps prints megabits per second, the default.
+	UnitMbps SpeedUnit = iota
+	// UnitGbps prints gigabits per second.
+	UnitGbps
+	// UnitMBps prints megabytes (10^6 bytes) per second.
+	UnitMBps
+	// UnitMiBps prints mebibytes (2^20 bytes) per second.
+	UnitMiBps
+	// UnitAuto prints kbps, Mbps or Gbps, whichever keeps the number
+	// between 1 and 1000.
+	UnitAuto
+)
+
+var speedUnits = []string{"Mbps", "Gbps", "MB/s", "MiB/s", "auto"}
+
+func (u SpeedUnit) String() string {
+	if int(u) < len(speedUnits) {
+		return speedUnits[u]
+	}
+	return speedUnits[UnitMbps]
+}
+
+// ParseSpeedUnit reads a unit name as printed by String, ignoring case.
+func ParseSpeedUnit(s string) (SpeedUnit, error) {
+	for i, name := range speedUnits {
+		if strings.EqualFold(s, name) {
+			return SpeedUnit(i), nil
+		}
+	}
+	return UnitMbps, fmt.Errorf("unknown unit %q, want one of %s", s, strings.Join(speedUnits, ", "))
+}
+
+// Convert returns a speed given in Mbps in the unit, along with the name
+// of the unit it ended up in.
+func (u SpeedUnit) Convert(mbps float64) (float64, string) {
+	switch u {
+	case UnitGbps:
+		return mbps / 1000, "Gbps"
+	case UnitMBps:
+		return mbps / 8, "MB/s"
+	case UnitMiBps:
+		return mbps * 1000000 / 8 / (1 << 20), "MiB/s"
+	case UnitAuto:
+		switch {
+		case mbps >= 1000:
+			return mbps / 1000, "Gbps"
+		case mbps > 0 && mbps < 1:
+			return mbps * 1000, "kbps"
+		}
+	}
+	return mbps, "Mbps"
+}
+
+// Format prints a speed given in Mbps in the unit, e.g. "94.20 Mbps".
+func (u SpeedUnit) Format(mbps float64) string {
+	v, name := u.Convert(mbps)
+	return fmt.Sprintf("%.2f %s", v, name)
+}
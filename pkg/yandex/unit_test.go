@@ -0,0 +1,81 @@
+package yandex
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSpeedUnitConvert(t *testing.T) {
+	for _, tc := range []struct {
+		unit     SpeedUnit
+		mbps     float64
+		want     float64
+		wantName string
+	}{
+		{UnitMbps, 94.2, 94.2, "Mbps"},
+		{UnitMbps, 0.5, 0.5, "Mbps"},
+		{UnitGbps, 2500, 2.5, "Gbps"},
+		{UnitMBps, 80, 10, "MB/s"},
+		// 2^20 bytes a second
+		{UnitMiBps, 8.388608, 1, "MiB/s"},
+		{UnitMiBps, 100, 11.920928955078125, "MiB/s"},
+		{UnitAuto, 0, 0, "Mbps"},
+		{UnitAuto, 0.0005, 0.5, "kbps"},
+		{UnitAuto, 0.999, 999, "kbps"},
+		{UnitAuto, 1, 1, "Mbps"},
+		{UnitAuto, 999.99, 999.99, "Mbps"},
+		{UnitAuto, 1000, 1, "Gbps"},
+		{UnitAuto, 12500, 12.5, "Gbps"},
+	} {
+		got, name := tc.unit.Convert(tc.mbps)
+		if math.Abs(got-tc.want) > 1e-9 || name != tc.wantName {
+			t.Errorf("%v.Convert(%v) = %v %s, want %v %s", tc.unit, tc.mbps, got, name, tc.want, tc.wantName)
+		}
+	}
+}
+
+func TestSpeedUnitFormat(t *testing.T) {
+	for _, tc := range []struct {
+		unit SpeedUnit
+		mbps float64
+		want string
+	}{
+		{UnitMbps, 94.2, "94.20 Mbps"},
+		{UnitMiBps, 100, "11.92 MiB/s"},
+		{UnitAuto, 0.25, "250.00 kbps"},
+		{UnitAuto, 1250, "1.25 Gbps"},
+	} {
+		if got := tc.unit.Format(tc.mbps); got != tc.want {
+			t.Errorf("%v.Format(%v) = %q, want %q", tc.unit, tc.mbps, got, tc.want)
+		}
+	}
+}
+
+func TestParseSpeedUnit(t *testing.T) {
+	for _, tc := range []struct {
+		s       string
+		want    SpeedUnit
+		wantErr bool
+	}{
+		{s: "Mbps", want: UnitMbps},
+		{s: "mbps", want: UnitMbps},
+		{s: "GBPS", want: UnitGbps},
+		{s: "MB/s", want: UnitMBps},
+		{s: "mib/s", want: UnitMiBps},
+		{s: "Auto", want: UnitAuto},
+		{s: "kbps", wantErr: true},
+		{s: "MiB", wantErr: true},
+		{s: "", wantErr: true},
+	} {
+		got, err := ParseSpeedUnit(tc.s)
+		if (err != nil) != tc.wantErr || (!tc.wantErr && got != tc.want) {
+			t.Errorf("ParseSpeedUnit(%q) = %v, %v; want %v, error %v", tc.s, got, err, tc.want, tc.wantErr)
+		}
+	}
+	// every unit reads back from its name
+	for u := UnitMbps; u <= UnitAuto; u++ {
+		if got, err := ParseSpeedUnit(u.String()); err != nil || got != u {
+			t.Errorf("ParseSpeedUnit(%q) = %v, %v; want %v", u.String(), got, err, u)
+		}
+	}
+}
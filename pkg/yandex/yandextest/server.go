@@ -0,0 +1,271 @@
+// Package yandextest provides an offline stand-in for the Yandex
+// Internetometer API, for tests and demos that must not touch the network.
+package yandextest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Master290/internetometer-cli/pkg/yandex"
+)
+
+// Endpoint names accepted by Options.Status, Options.Drop and Server.Hits.
+const (
+	Probes   = "probes"
+	Latency  = "latency"
+	Download = "download"
+	Upload   = "upload"
+	IPv4     = "ipv4"
+	IPv6     = "ipv6"
+	DateTime = "datetime"
+	Region   = "region"
+	ISP      = "isp"
+)
+
+type Options struct {
+	// Bandwidth caps every download and upload body, in bytes per second.
+	// Zero means unlimited.
+	Bandwidth int64
+	// Latency is added before every response.
+	Latency time.Duration
+	// Status forces a response code per endpoint, e.g. {Upload: 403}.
+	Status map[string]int
+	// Drop aborts the connection per endpoint. Downloads are cut after
+	// DropAfter bytes, everything else before the response is written.
+	Drop      map[string]bool
+	DropAfter int64
+
+	IPv4   string
+	IPv6   string
+	Region string
+	ISP    string
+	ASN    int
+}
+
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	opts     Options
+	hits     map[string]int
+	uploaded int64
+}
+
+// NewServer starts a fake Internetometer. Call Close when done.
+func NewServer(opts Options) *Server {
+	s := &Server{
+		hits: make(map[string]int),
+	}
+	s.SetOptions(opts)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/internet/api/v0/get-probes", s.handle(Probes, s.serveProbes))
+	mux.HandleFunc("/internet/api/v1/datetime", s.handle(DateTime, s.serveDateTime))
+	mux.HandleFunc("/internet", s.handle(Region, s.serveRegion))
+	mux.HandleFunc("/ping", s.handle(Latency, s.servePing))
+	mux.HandleFunc("/download/", s.handle(Download, s.serveDownload))
+	mux.HandleFunc("/upload", s.handle(Upload, s.serveUpload))
+	mux.HandleFunc("/ipv4", s.handle(IPv4, s.serveIPv4))
+	mux.HandleFunc("/ipv6", s.handle(IPv6, s.serveIPv6))
+	mux.HandleFunc("/isp", s.handle(ISP, s.serveISP))
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// SetOptions replaces the knobs of a running server.
+func (s *Server) SetOptions(opts Options) {
+	if opts.IPv4 == "" {
+		opts.IPv4 = "192.0.2.1"
+	}
+	if opts.Region == "" {
+		opts.Region = "Moscow"
+	}
+	if opts.ISP == "" {
+		opts.ISP = "Example Telecom"
+	}
+	if opts.ASN == 0 {
+		opts.ASN = 64500
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts = opts
+}
+
+// Config returns a client configuration with every endpoint pointed at s.
+func (s *Server) Config() *yandex.Config {
+	return &yandex.Config{
+		BaseURL: s.URL + "/internet",
+		Endpoints: yandex.Endpoints{
+			IPv4: s.URL + "/ipv4",
+			IPv6: s.URL + "/ipv6",
+			ISP:  s.URL + "/isp",
+		},
+	}
+}
+
+// Hits reports how many requests an endpoint has received.
+func (s *Server) Hits(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[endpoint]
+}
+
+// Uploaded reports the total number of bytes received by the upload sink.
+func (s *Server) Uploaded() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploaded
+}
+
+func (s *Server) handle(endpoint string, h func(http.ResponseWriter, *http.Request, Options)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.hits[endpoint]++
+		opts := s.opts
+		s.mu.Unlock()
+
+		if opts.Latency > 0 {
+			select {
+			case <-time.After(opts.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if opts.Drop[endpoint] && endpoint != Download {
+			panic(http.ErrAbortHandler)
+		}
+		if code := opts.Status[endpoint]; code != 0 {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		h(w, r, opts)
+	}
+}
+
+func (s *Server) serveProbes(w http.ResponseWriter, r *http.Request, opts Options) {
+	var resp yandex.ProbesResponse
+	resp.MID = "yandextest"
+	for i := 0; i < 3; i++ {
+		resp.Latency.Probes = append(resp.Latency.Probes, yandex.Probe{
+			URL:     fmt.Sprintf("%s/ping?probe=%d", s.URL, i),
+			Timeout: 1000,
+		})
+	}
+	resp.Download.Probes = []yandex.Probe{
+		{URL: s.URL + "/download/100kb", Timeout: 1000},
+		{URL: s.URL + "/download/50mb", Timeout: 10000},
+	}
+	resp.Upload.Warmup.Duration = 2000
+	resp.Upload.Probes = append(resp.Upload.Probes, struct {
+		Size int    `json:"size"`
+		URL  string `json:"url"`
+	}{Size: 50 << 20, URL: s.URL + "/upload"})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) serveDateTime(w http.ResponseWriter, r *http.Request, opts Options) {
+	fmt.Fprint(w, time.Now().UnixMilli())
+}
+
+func (s *Server) serveRegion(w http.ResponseWriter, r *http.Request, opts Options) {
+	region, _ := json.Marshal(map[string]interface{}{"id": 213, "name": opts.Region})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html><html><body><script>window.__DATA__ = {"clientRegion":%s};</script></body></html>`, region)
+}
+
+func (s *Server) servePing(w http.ResponseWriter, r *http.Request, opts Options) {
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request, opts Options) {
+	size, err := parseSize(strings.TrimPrefix(r.URL.Path, "/download/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	limit := size
+	if opts.Drop[Download] && opts.DropAfter < size {
+		limit = opts.DropAfter
+	}
+	shaped := &shapedWriter{w: w, bandwidth: opts.Bandwidth, start: time.Now()}
+	if _, err := io.CopyN(shaped, zeroReader{}, limit); err != nil {
+		return
+	}
+	if limit < size {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, opts Options) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	sink := writerFunc(func(p []byte) (int, error) {
+		s.mu.Lock()
+		s.uploaded += int64(len(p))
+		s.mu.Unlock()
+		return len(p), nil
+	})
+	shaped := &shapedWriter{w: sink, bandwidth: opts.Bandwidth, start: time.Now()}
+	io.Copy(shaped, r.Body)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) serveIPv4(w http.ResponseWriter, r *http.Request, opts Options) {
+	json.NewEncoder(w).Encode(opts.IPv4)
+}
+
+func (s *Server) serveIPv6(w http.ResponseWriter, r *http.Request, opts Options) {
+	if opts.IPv6 == "" {
+		http.Error(w, "no ipv6", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(opts.IPv6)
+}
+
+func (s *Server) serveISP(w http.ResponseWriter, r *http.Request, opts Options) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"isp": opts.ISP,
+		"as":  fmt.Sprintf("AS%d %s", opts.ASN, opts.ISP),
+	})
+}
+
+// parseSize understands the "100kb" / "50mb" suffixes used in probe URLs.
+func parseSize(s string) (int64, error) {
+	s = strings.ToLower(s)
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "kb"):
+		mult, s = 1<<10, strings.TrimSuffix(s, "kb")
+	case strings.HasSuffix(s, "mb"):
+		mult, s = 1<<20, strings.TrimSuffix(s, "mb")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return n * mult, nil
+}
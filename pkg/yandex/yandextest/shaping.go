@@ -0,0 +1,55 @@
+package yandextest
+
+import (
+	"io"
+	"time"
+)
+
+const chunkSize = 32 << 10
+
+// shapedWriter paces writes so that the average rate since start stays at
+// or below bandwidth bytes per second.
+type shapedWriter struct {
+	w         io.Writer
+	bandwidth int64
+	start     time.Time
+	written   int64
+}
+
+func (s *shapedWriter) Write(p []byte) (int, error) {
+	var total int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		n, err := s.w.Write(chunk)
+		total += n
+		s.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+
+		if s.bandwidth > 0 {
+			due := time.Duration(float64(s.written) / float64(s.bandwidth) * float64(time.Second))
+			if wait := due - time.Since(s.start); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+	}
+	return total, nil
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}